@@ -0,0 +1,339 @@
+package apu
+
+import (
+	go_gb "go-gb"
+	"io"
+	"math"
+)
+
+const (
+	frameSequencerBit = 4 // falling edge of this DIV bit clocks the frame sequencer (512 Hz)
+	registerCount     = go_gb.SoundEnd - go_gb.SoundStart + 1
+
+	clockRate   = 4_194_304 / 4  // M cycles per second
+	flushClocks = clockRate / 64 // how often resampled frames are sent to the sink
+)
+
+// bits that always read as 1, indexed from NR10 (unused registers read as 0xFF)
+var readMasks = [go_gb.WaveRAMStart - go_gb.SoundStart]byte{
+	0x80, 0x3F, 0x00, 0xFF, 0xBF, // NR10-NR14
+	0xFF, 0x3F, 0x00, 0xFF, 0xBF, // unused, NR21-NR24
+	0x7F, 0xFF, 0x9F, 0xFF, 0xBF, // NR30-NR34
+	0xFF, 0xFF, 0x00, 0x00, 0xBF, // unused, NR41-NR44
+	0x00, 0x00, 0x70, // NR50-NR52
+	0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, // unused
+}
+
+type apu struct {
+	io go_gb.Memory // used for reading DIV
+
+	registers [registerCount]byte
+
+	enabled bool
+	ch1     square
+	ch2     square
+	ch3     wave
+	ch4     noise
+
+	frameStep byte // next frame sequencer step
+	lastDiv   byte
+
+	sink                go_gb.AudioSink
+	left, right         *blip
+	lastLeft, lastRight float32
+	clock               uint // M cycles since the last flush
+	samples             [2][]float64
+	frames              []go_gb.AudioFrame
+}
+
+func NewApu(io go_gb.Memory) *apu {
+	return &apu{
+		io:  io,
+		ch1: newSquare(true),
+		ch2: newSquare(false),
+		ch3: newWave(),
+		ch4: newNoise(),
+	}
+}
+
+func (a *apu) state() []interface{} {
+	values := []interface{}{&a.registers, &a.enabled, &a.frameStep, &a.lastDiv}
+	values = append(values, a.ch1.state()...)
+	values = append(values, a.ch2.state()...)
+	values = append(values, a.ch3.state()...)
+	return append(values, a.ch4.state()...)
+}
+
+// the sink and its resampling buffers are not part of the state
+func (a *apu) SaveState(w io.Writer) error {
+	return go_gb.WriteState(w, a.state()...)
+}
+
+func (a *apu) LoadState(r io.Reader) error {
+	return go_gb.ReadState(r, a.state()...)
+}
+
+// sets the sink that receives the output resampled to the sink sample rate
+func (a *apu) SetSink(sink go_gb.AudioSink) {
+	factor := float64(sink.SampleRate()) / clockRate
+	a.sink = sink
+	a.left = newBlip(factor)
+	a.right = newBlip(factor)
+	a.clock = 0
+}
+
+func (a *apu) Step(mc go_gb.MC) {
+	div := a.io.Read(go_gb.DIV)
+	fell := go_gb.Bit(a.lastDiv, frameSequencerBit) && !go_gb.Bit(div, frameSequencerBit)
+	a.lastDiv = div
+	if a.enabled && fell {
+		a.clockFrameSequencer()
+	}
+	for i := go_gb.MC(0); i < mc; i++ {
+		if a.enabled {
+			a.ch1.step(4)
+			a.ch2.step(4)
+			a.ch3.step(4)
+			a.ch4.step(4)
+		}
+		if a.sink != nil {
+			a.mix()
+		}
+	}
+}
+
+// records the output change in the current M cycle and flushes resampled frames to the sink
+func (a *apu) mix() {
+	left, right := a.Output()
+	if left != a.lastLeft {
+		a.left.addDelta(a.clock, float64(left-a.lastLeft))
+		a.lastLeft = left
+	}
+	if right != a.lastRight {
+		a.right.addDelta(a.clock, float64(right-a.lastRight))
+		a.lastRight = right
+	}
+	a.clock += 1
+	if a.clock >= flushClocks {
+		a.flush()
+	}
+}
+
+func (a *apu) flush() {
+	n := a.left.endFrame(a.clock)
+	a.right.endFrame(a.clock)
+	a.clock = 0
+	for i := range a.samples {
+		if cap(a.samples[i]) < n {
+			a.samples[i] = make([]float64, n)
+		}
+		a.samples[i] = a.samples[i][:n]
+	}
+	a.left.read(a.samples[0])
+	a.right.read(a.samples[1])
+
+	if cap(a.frames) < n {
+		a.frames = make([]go_gb.AudioFrame, n)
+	}
+	a.frames = a.frames[:n]
+	for i := range a.frames {
+		a.frames[i] = go_gb.AudioFrame{Left: toPcm(a.samples[0][i]), Right: toPcm(a.samples[1][i])}
+	}
+	a.sink.Play(a.frames)
+}
+
+func toPcm(val float64) int16 {
+	val *= math.MaxInt16
+	if val > math.MaxInt16 {
+		return math.MaxInt16
+	} else if val < math.MinInt16 {
+		return math.MinInt16
+	}
+	return int16(val)
+}
+
+func (a *apu) clockFrameSequencer() {
+	switch a.frameStep {
+	case 0, 4:
+		a.clockLength()
+	case 2, 6:
+		a.clockLength()
+		a.ch1.clockSweep()
+	case 7:
+		a.ch1.envelope.clock()
+		a.ch2.envelope.clock()
+		a.ch4.envelope.clock()
+	}
+	a.frameStep = (a.frameStep + 1) & 0x7
+}
+
+func (a *apu) clockLength() {
+	a.ch1.clockLength()
+	a.ch2.clockLength()
+	a.ch3.clockLength()
+	a.ch4.clockLength()
+}
+
+// returns true if the next frame sequencer step clocks the length counters
+func (a *apu) lengthStepNext() bool {
+	return a.frameStep%2 == 0
+}
+
+// converts a digital channel output (0-15) to an analog value in range [-1, 1]
+func dac(enabled bool, val byte) float32 {
+	if !enabled {
+		return 0
+	}
+	return float32(val)/7.5 - 1
+}
+
+// returns the current mixed left and right output, each in range [-1, 1]
+func (a *apu) Output() (float32, float32) {
+	if !a.enabled {
+		return 0, 0
+	}
+	channels := [4]float32{
+		dac(a.ch1.dacEnabled, a.ch1.output()),
+		dac(a.ch2.dacEnabled, a.ch2.output()),
+		dac(a.ch3.dacEnabled, a.ch3.output()),
+		dac(a.ch4.dacEnabled, a.ch4.output()),
+	}
+	panning := a.registers[go_gb.NR51-go_gb.SoundStart]
+	var left, right float32
+	for i, val := range channels {
+		if go_gb.Bit(panning, i+4) {
+			left += val
+		}
+		if go_gb.Bit(panning, i) {
+			right += val
+		}
+	}
+	volume := a.registers[go_gb.NR50-go_gb.SoundStart]
+	left *= float32((volume>>4)&0x7+1) / 8
+	right *= float32(volume&0x7+1) / 8
+	return left / 4, right / 4
+}
+
+func (a *apu) Read(pointer uint16) byte {
+	if go_gb.WaveRAMStart <= pointer && pointer <= go_gb.WaveRAMEnd {
+		return a.ch3.readRam(pointer - go_gb.WaveRAMStart)
+	}
+	if pointer == go_gb.NR52 {
+		result := byte(0x70)
+		go_gb.Set(&result, 7, a.enabled)
+		go_gb.Set(&result, 0, a.ch1.enabled)
+		go_gb.Set(&result, 1, a.ch2.enabled)
+		go_gb.Set(&result, 2, a.ch3.enabled)
+		go_gb.Set(&result, 3, a.ch4.enabled)
+		return result
+	}
+	i := pointer - go_gb.SoundStart
+	return a.registers[i] | readMasks[i]
+}
+
+func (a *apu) ReadBytes(pointer, n uint16) []byte {
+	return go_gb.ReadBytes(a, pointer, n)
+}
+
+func (a *apu) Store(pointer uint16, val byte) {
+	if go_gb.WaveRAMStart <= pointer && pointer <= go_gb.WaveRAMEnd {
+		a.ch3.writeRam(pointer-go_gb.WaveRAMStart, val)
+		return
+	}
+	if pointer == go_gb.NR52 {
+		a.setPower(val&0x80 != 0)
+		return
+	}
+	if !a.enabled {
+		// length counters can still be written while powered off (DMG)
+		switch pointer {
+		case go_gb.NR11:
+			a.ch1.length.load(val & 0x3F)
+		case go_gb.NR21:
+			a.ch2.length.load(val & 0x3F)
+		case go_gb.NR31:
+			a.ch3.writeLength(val)
+		case go_gb.NR41:
+			a.ch4.writeLength(val)
+		}
+		return
+	}
+	a.storeRegister(pointer, val)
+}
+
+func (a *apu) StoreBytes(pointer uint16, bytes []byte) {
+	go_gb.WriteBytes(a, pointer, bytes)
+}
+
+func (a *apu) storeRegister(pointer uint16, val byte) {
+	a.registers[pointer-go_gb.SoundStart] = val
+	switch pointer {
+	case go_gb.NR10:
+		a.ch1.writeSweep(val)
+	case go_gb.NR11:
+		a.ch1.writeLength(val)
+	case go_gb.NR12:
+		a.ch1.writeEnvelope(val)
+	case go_gb.NR13:
+		a.ch1.writeFrequencyLow(val)
+	case go_gb.NR14:
+		a.ch1.writeFrequencyHigh(val, a.lengthStepNext())
+	case go_gb.NR21:
+		a.ch2.writeLength(val)
+	case go_gb.NR22:
+		a.ch2.writeEnvelope(val)
+	case go_gb.NR23:
+		a.ch2.writeFrequencyLow(val)
+	case go_gb.NR24:
+		a.ch2.writeFrequencyHigh(val, a.lengthStepNext())
+	case go_gb.NR30:
+		a.ch3.writeDac(val)
+	case go_gb.NR31:
+		a.ch3.writeLength(val)
+	case go_gb.NR32:
+		a.ch3.writeVolume(val)
+	case go_gb.NR33:
+		a.ch3.writeFrequencyLow(val)
+	case go_gb.NR34:
+		a.ch3.writeFrequencyHigh(val, a.lengthStepNext())
+	case go_gb.NR41:
+		a.ch4.writeLength(val)
+	case go_gb.NR42:
+		a.ch4.writeEnvelope(val)
+	case go_gb.NR43:
+		a.ch4.writePolynomial(val)
+	case go_gb.NR44:
+		a.ch4.writeControl(val, a.lengthStepNext())
+	}
+}
+
+func (a *apu) setPower(on bool) {
+	if on == a.enabled {
+		return
+	}
+	if !on {
+		// powering off clears every register except the length counters (DMG), wave RAM is left untouched
+		for pointer := go_gb.NR10; pointer < go_gb.NR52; pointer++ {
+			switch pointer {
+			case go_gb.NR11, go_gb.NR21:
+				a.registers[pointer-go_gb.SoundStart] = 0
+			case go_gb.NR31, go_gb.NR41:
+			default:
+				a.storeRegister(pointer, 0)
+			}
+		}
+		a.ch1.duty = 0
+		a.ch2.duty = 0
+		a.ch1.enabled = false
+		a.ch2.enabled = false
+		a.ch3.enabled = false
+		a.ch4.enabled = false
+		a.enabled = false
+		return
+	}
+	a.enabled = true
+	a.frameStep = 0
+	a.ch1.dutyPos = 0
+	a.ch2.dutyPos = 0
+	a.ch3.sample = 0
+}
@@ -0,0 +1,171 @@
+package apu
+
+import (
+	go_gb "go-gb"
+	"testing"
+)
+
+type mockIO struct {
+	div byte
+}
+
+func (m *mockIO) ReadBytes(pointer, n uint16) []byte {
+	panic("implement me")
+}
+
+func (m *mockIO) Read(pointer uint16) byte {
+	return m.div
+}
+
+func (m *mockIO) StoreBytes(pointer uint16, bytes []byte) {
+	panic("implement me")
+}
+
+func (m *mockIO) Store(pointer uint16, val byte) {
+	panic("implement me")
+}
+
+// steps the APU through a single frame sequencer clock
+func clockFrameSequencer(a *apu, io *mockIO) {
+	io.div = 0x10
+	a.Step(1)
+	io.div = 0x20
+	a.Step(1)
+}
+
+func TestApu_PowerOff(t *testing.T) {
+	a := NewApu(&mockIO{})
+	a.Store(go_gb.NR52, 0x80)
+	a.Store(go_gb.NR12, 0xF0)
+	a.Store(go_gb.NR50, 0x77)
+	a.Store(go_gb.WaveRAMStart, 0x12)
+
+	a.Store(go_gb.NR52, 0x00)
+	if val := a.Read(go_gb.NR12); val != 0 {
+		t.Errorf("expected NR12 to be cleared, got %X\n", val)
+	}
+	if val := a.Read(go_gb.NR50); val != 0 {
+		t.Errorf("expected NR50 to be cleared, got %X\n", val)
+	}
+	if val := a.Read(go_gb.NR52); val != 0x70 {
+		t.Errorf("expected NR52 %X, got %X\n", 0x70, val)
+	}
+	if val := a.Read(go_gb.WaveRAMStart); val != 0x12 {
+		t.Errorf("expected wave RAM to be kept, got %X\n", val)
+	}
+	a.Store(go_gb.NR12, 0xF0)
+	if val := a.Read(go_gb.NR12); val != 0 {
+		t.Errorf("expected writes to be ignored while powered off, got %X\n", val)
+	}
+}
+
+func TestApu_ReadMasks(t *testing.T) {
+	a := NewApu(&mockIO{})
+	a.Store(go_gb.NR52, 0x80)
+	if val := a.Read(go_gb.NR13); val != 0xFF {
+		t.Errorf("expected write only register to read %X, got %X\n", 0xFF, val)
+	}
+	a.Store(go_gb.NR11, 0x80)
+	if val := a.Read(go_gb.NR11); val != 0xBF {
+		t.Errorf("expected NR11 %X, got %X\n", 0xBF, val)
+	}
+}
+
+func TestApu_Trigger(t *testing.T) {
+	a := NewApu(&mockIO{})
+	a.Store(go_gb.NR52, 0x80)
+	a.Store(go_gb.NR14, 0x80)
+	if a.Read(go_gb.NR52)&0x01 != 0 {
+		t.Error("channel 1 should stay disabled with its DAC off")
+	}
+	a.Store(go_gb.NR12, 0xF0)
+	a.Store(go_gb.NR14, 0x80)
+	if a.Read(go_gb.NR52)&0x01 == 0 {
+		t.Error("channel 1 should be enabled after trigger")
+	}
+	a.Store(go_gb.NR12, 0x00)
+	if a.Read(go_gb.NR52)&0x01 != 0 {
+		t.Error("disabling the DAC should disable channel 1")
+	}
+}
+
+func TestApu_LengthCounter(t *testing.T) {
+	io := &mockIO{}
+	a := NewApu(io)
+	a.Store(go_gb.NR52, 0x80)
+	a.Store(go_gb.NR22, 0xF0)
+	a.Store(go_gb.NR21, 64-2) // length of 2
+	a.Store(go_gb.NR24, 0xC0) // trigger with length enabled
+
+	clockFrameSequencer(a, io) // step 0 clocks length
+	if a.Read(go_gb.NR52)&0x02 == 0 {
+		t.Fatal("channel 2 disabled too early")
+	}
+	clockFrameSequencer(a, io) // step 1 doesn't clock length
+	clockFrameSequencer(a, io) // step 2 clocks length
+	if a.Read(go_gb.NR52)&0x02 != 0 {
+		t.Error("channel 2 should be disabled by its length counter")
+	}
+}
+
+func TestApu_SweepOverflow(t *testing.T) {
+	a := NewApu(&mockIO{})
+	a.Store(go_gb.NR52, 0x80)
+	a.Store(go_gb.NR12, 0xF0)
+	a.Store(go_gb.NR10, 0x11) // period 1, addition, shift 1
+	a.Store(go_gb.NR13, 0xFF)
+	a.Store(go_gb.NR14, 0x87) // frequency 0x7FF, trigger
+	if a.Read(go_gb.NR52)&0x01 != 0 {
+		t.Error("sweep overflow on trigger should disable channel 1")
+	}
+}
+
+func TestNoise_Lfsr(t *testing.T) {
+	n := newNoise()
+	n.writePolynomial(0x08) // 7-bit mode, divisor 8
+	n.timer = n.period()
+	n.step(n.period())
+	if n.lfsr != 0x3FBF {
+		t.Errorf("expected LFSR %X, got %X\n", 0x3FBF, n.lfsr)
+	}
+}
+
+type mockSink struct {
+	frames []go_gb.AudioFrame
+}
+
+func (m *mockSink) SampleRate() int {
+	return go_gb.SampleRate48000
+}
+
+func (m *mockSink) Play(frames []go_gb.AudioFrame) {
+	m.frames = append(m.frames, frames...)
+}
+
+func TestApu_SetSink(t *testing.T) {
+	a := NewApu(&mockIO{})
+	sink := &mockSink{}
+	a.SetSink(sink)
+	a.Store(go_gb.NR52, 0x80)
+	a.Store(go_gb.NR50, 0x77)
+	a.Store(go_gb.NR51, 0x22)
+	a.Store(go_gb.NR22, 0xF0)
+	a.Store(go_gb.NR23, 0x00)
+	a.Store(go_gb.NR24, 0x86) // ~1 kHz, trigger
+
+	a.Step(clockRate) // one second
+	expected := go_gb.SampleRate48000
+	if diff := len(sink.frames) - expected; diff < -blipWidth || diff > blipWidth {
+		t.Fatalf("expected ~%d frames, got %d\n", expected, len(sink.frames))
+	}
+	var nonZero bool
+	for _, frame := range sink.frames {
+		if frame.Left != frame.Right {
+			t.Fatalf("expected equal channels, got %v\n", frame)
+		}
+		nonZero = nonZero || frame.Left != 0
+	}
+	if !nonZero {
+		t.Error("expected audible output")
+	}
+}
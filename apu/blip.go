@@ -0,0 +1,88 @@
+package apu
+
+import "math"
+
+const (
+	blipPhases = 32 // sub-sample resolution of a delta
+	blipWidth  = 16 // kernel taps, the output is delayed by half of this
+	blipCutoff = 0.9
+	highPass   = 0.999 // removes the DC offset, like the capacitor on the real hardware
+)
+
+var blipKernel = newBlipKernel()
+
+// windowed sinc impulses for each sub-sample phase, each phase sums to 1
+func newBlipKernel() [blipPhases][blipWidth]float64 {
+	var kernel [blipPhases][blipWidth]float64
+	for phase := 0; phase < blipPhases; phase++ {
+		frac := float64(phase) / blipPhases
+		var sum float64
+		for tap := 0; tap < blipWidth; tap++ {
+			x := float64(tap-blipWidth/2+1) - frac
+			sinc := 1.0
+			if x != 0 {
+				sinc = math.Sin(math.Pi*x*blipCutoff) / (math.Pi * x * blipCutoff)
+			}
+			window := 0.42 + 0.5*math.Cos(2*math.Pi*x/blipWidth) + 0.08*math.Cos(4*math.Pi*x/blipWidth)
+			kernel[phase][tap] = sinc * window
+			sum += kernel[phase][tap]
+		}
+		for tap := range kernel[phase] {
+			kernel[phase][tap] /= sum
+		}
+	}
+	return kernel
+}
+
+// band-limited synthesis buffer, converts amplitude changes at clock times to samples at the host rate
+type blip struct {
+	factor float64 // output samples per clock
+	offset float64 // fractional output position of the current frame start
+
+	buf []float64
+
+	integrator float64
+	lastIn     float64
+	lastOut    float64
+}
+
+func newBlip(factor float64) *blip {
+	return &blip{factor: factor}
+}
+
+func (b *blip) addDelta(clock uint, delta float64) {
+	pos := b.offset + float64(clock)*b.factor
+	i := int(pos)
+	phase := int((pos - float64(i)) * blipPhases)
+	if needed := i + 1 + blipWidth; needed > len(b.buf) {
+		b.buf = append(b.buf, make([]float64, needed-len(b.buf))...)
+	}
+	for tap, weight := range blipKernel[phase] {
+		b.buf[i+1+tap] += delta * weight
+	}
+}
+
+// ends the current frame after the given number of clocks and returns the number of available samples
+func (b *blip) endFrame(clocks uint) int {
+	pos := b.offset + float64(clocks)*b.factor
+	n := int(pos)
+	b.offset = pos - float64(n)
+	if n > len(b.buf) {
+		b.buf = append(b.buf, make([]float64, n-len(b.buf))...)
+	}
+	return n
+}
+
+// integrates and removes the first len(out) samples
+func (b *blip) read(out []float64) {
+	for i := range out {
+		b.integrator += b.buf[i]
+		b.lastOut = b.integrator - b.lastIn + highPass*b.lastOut
+		b.lastIn = b.integrator
+		out[i] = b.lastOut
+	}
+	n := copy(b.buf, b.buf[len(out):])
+	for i := n; i < len(b.buf); i++ {
+		b.buf[i] = 0
+	}
+}
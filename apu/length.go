@@ -0,0 +1,91 @@
+package apu
+
+// counts down the remaining length of a channel, disabling it when it reaches 0
+type lengthCounter struct {
+	enabled bool
+	counter uint16
+	max     uint16
+}
+
+func (l *lengthCounter) state() []interface{} {
+	return []interface{}{&l.enabled, &l.counter}
+}
+
+func (l *lengthCounter) load(val byte) {
+	l.counter = l.max - uint16(val)
+}
+
+// returns true if the channel should be disabled
+func (l *lengthCounter) clock() bool {
+	if !l.enabled || l.counter == 0 {
+		return false
+	}
+	l.counter -= 1
+	return l.counter == 0
+}
+
+// handles the NRx4 length enable write and the trigger reload.
+//
+// If the next frame sequencer step doesn't clock the length counter, enabling the length counter
+// clocks it once more (obscure, but games and test ROMs depend on it).
+// Returns true if the channel should be disabled.
+func (l *lengthCounter) write(enable, trigger, lengthStepNext bool) bool {
+	disable := false
+	wasEnabled := l.enabled
+	l.enabled = enable
+	if !lengthStepNext && !wasEnabled && enable && l.counter != 0 {
+		l.counter -= 1
+		disable = l.counter == 0 && !trigger
+	}
+	if trigger && l.counter == 0 {
+		l.counter = l.max
+		if enable && !lengthStepNext {
+			l.counter -= 1
+		}
+	}
+	return disable
+}
+
+// volume envelope used by square and noise channels
+type envelope struct {
+	initial  byte
+	increase bool
+	period   byte
+
+	volume byte
+	timer  byte
+}
+
+func (e *envelope) state() []interface{} {
+	return []interface{}{&e.initial, &e.increase, &e.period, &e.volume, &e.timer}
+}
+
+func (e *envelope) load(val byte) {
+	e.initial = val >> 4
+	e.increase = val&0x08 != 0
+	e.period = val & 0x07
+}
+
+func (e *envelope) trigger() {
+	e.volume = e.initial
+	e.timer = e.period
+	if e.timer == 0 {
+		e.timer = 8
+	}
+}
+
+func (e *envelope) clock() {
+	if e.period == 0 {
+		return
+	}
+	e.timer -= 1
+	if e.timer != 0 {
+		return
+	}
+	e.timer = e.period
+	if e.increase && e.volume < 15 {
+		e.volume += 1
+	} else if !e.increase && e.volume > 0 {
+		e.volume -= 1
+	}
+}
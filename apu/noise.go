@@ -0,0 +1,90 @@
+package apu
+
+// noise channel, outputs the inverted lowest bit of a linear feedback shift register
+type noise struct {
+	enabled    bool
+	dacEnabled bool
+
+	length   lengthCounter
+	envelope envelope
+
+	clockShift byte
+	widthMode  bool // 7-bit LFSR if set, 15-bit otherwise
+	divisor    byte
+	timer      int
+	lfsr       uint16
+}
+
+func (n *noise) state() []interface{} {
+	values := []interface{}{&n.enabled, &n.dacEnabled, &n.clockShift, &n.widthMode, &n.divisor, &n.timer, &n.lfsr}
+	values = append(values, n.length.state()...)
+	return append(values, n.envelope.state()...)
+}
+
+func newNoise() noise {
+	return noise{length: lengthCounter{max: 64}, lfsr: 0x7FFF}
+}
+
+func (n *noise) period() int {
+	divisor := int(n.divisor) * 16
+	if divisor == 0 {
+		divisor = 8
+	}
+	return divisor << n.clockShift
+}
+
+func (n *noise) step(t int) {
+	n.timer -= t
+	for n.timer <= 0 {
+		n.timer += n.period()
+		xor := (n.lfsr & 0x01) ^ ((n.lfsr >> 1) & 0x01)
+		n.lfsr = (n.lfsr >> 1) | (xor << 14)
+		if n.widthMode {
+			n.lfsr = (n.lfsr &^ (1 << 6)) | (xor << 6)
+		}
+	}
+}
+
+func (n *noise) output() byte {
+	if !n.enabled || n.lfsr&0x01 != 0 {
+		return 0
+	}
+	return n.envelope.volume
+}
+
+func (n *noise) writeLength(val byte) {
+	n.length.load(val & 0x3F)
+}
+
+func (n *noise) writeEnvelope(val byte) {
+	n.envelope.load(val)
+	n.dacEnabled = val&0xF8 != 0
+	if !n.dacEnabled {
+		n.enabled = false
+	}
+}
+
+func (n *noise) writePolynomial(val byte) {
+	n.clockShift = val >> 4
+	n.widthMode = val&0x08 != 0
+	n.divisor = val & 0x07
+}
+
+func (n *noise) writeControl(val byte, lengthStepNext bool) {
+	trigger := val&0x80 != 0
+	if n.length.write(val&0x40 != 0, trigger, lengthStepNext) {
+		n.enabled = false
+	}
+	if trigger {
+		n.enabled = n.dacEnabled
+		n.timer = n.period()
+		n.lfsr = 0x7FFF
+		n.envelope.trigger()
+	}
+}
+
+func (n *noise) clockLength() {
+	if n.length.clock() {
+		n.enabled = false
+	}
+}
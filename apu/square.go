@@ -0,0 +1,190 @@
+package apu
+
+var dutyPatterns = [4][8]byte{
+	{0, 0, 0, 0, 0, 0, 0, 1}, // 12.5%
+	{1, 0, 0, 0, 0, 0, 0, 1}, // 25%
+	{1, 0, 0, 0, 0, 1, 1, 1}, // 50%
+	{0, 1, 1, 1, 1, 1, 1, 0}, // 75%
+}
+
+// frequency sweep, only present on channel 1
+type sweep struct {
+	period byte
+	negate bool
+	shift  byte
+
+	enabled     bool
+	timer       byte
+	shadow      uint16
+	negatedCalc bool // set when a calculation used the negate mode since the last trigger
+}
+
+func (s *sweep) state() []interface{} {
+	return []interface{}{&s.period, &s.negate, &s.shift, &s.enabled, &s.timer, &s.shadow, &s.negatedCalc}
+}
+
+func (s *sweep) load(val byte) bool {
+	s.period = (val >> 4) & 0x07
+	negate := val&0x08 != 0
+	s.shift = val & 0x07
+	// clearing the negate mode after it was used in a calculation disables the channel
+	disable := s.negate && !negate && s.negatedCalc
+	s.negate = negate
+	return disable
+}
+
+func (s *sweep) reloadTimer() {
+	s.timer = s.period
+	if s.timer == 0 {
+		s.timer = 8
+	}
+}
+
+// returns the new frequency and if it overflowed
+func (s *sweep) calculate() (uint16, bool) {
+	delta := s.shadow >> s.shift
+	var freq uint16
+	if s.negate {
+		freq = s.shadow - delta
+		s.negatedCalc = true
+	} else {
+		freq = s.shadow + delta
+	}
+	return freq, freq > 2047
+}
+
+type square struct {
+	enabled    bool
+	dacEnabled bool
+
+	length   lengthCounter
+	envelope envelope
+	sweep    *sweep
+
+	duty      byte
+	dutyPos   byte
+	frequency uint16
+	timer     int
+}
+
+func (s *square) state() []interface{} {
+	values := []interface{}{&s.enabled, &s.dacEnabled, &s.duty, &s.dutyPos, &s.frequency, &s.timer}
+	values = append(values, s.length.state()...)
+	values = append(values, s.envelope.state()...)
+	if s.sweep != nil {
+		values = append(values, s.sweep.state()...)
+	}
+	return values
+}
+
+func newSquare(withSweep bool) square {
+	s := square{length: lengthCounter{max: 64}}
+	if withSweep {
+		s.sweep = &sweep{}
+	}
+	return s
+}
+
+func (s *square) period() int {
+	return (2048 - int(s.frequency)) * 4
+}
+
+func (s *square) step(t int) {
+	s.timer -= t
+	for s.timer <= 0 {
+		s.timer += s.period()
+		s.dutyPos = (s.dutyPos + 1) & 0x7
+	}
+}
+
+func (s *square) output() byte {
+	if !s.enabled {
+		return 0
+	}
+	return dutyPatterns[s.duty][s.dutyPos] * s.envelope.volume
+}
+
+func (s *square) writeSweep(val byte) {
+	if s.sweep.load(val) {
+		s.enabled = false
+	}
+}
+
+func (s *square) writeLength(val byte) {
+	s.duty = val >> 6
+	s.length.load(val & 0x3F)
+}
+
+func (s *square) writeEnvelope(val byte) {
+	s.envelope.load(val)
+	s.dacEnabled = val&0xF8 != 0
+	if !s.dacEnabled {
+		s.enabled = false
+	}
+}
+
+func (s *square) writeFrequencyLow(val byte) {
+	s.frequency = (s.frequency & 0x700) | uint16(val)
+}
+
+func (s *square) writeFrequencyHigh(val byte, lengthStepNext bool) {
+	s.frequency = (s.frequency & 0xFF) | (uint16(val&0x07) << 8)
+	trigger := val&0x80 != 0
+	if s.length.write(val&0x40 != 0, trigger, lengthStepNext) {
+		s.enabled = false
+	}
+	if trigger {
+		s.trigger()
+	}
+}
+
+func (s *square) trigger() {
+	s.enabled = s.dacEnabled
+	s.timer = s.period()
+	s.envelope.trigger()
+	if s.sweep == nil {
+		return
+	}
+	sw := s.sweep
+	sw.shadow = s.frequency
+	sw.negatedCalc = false
+	sw.reloadTimer()
+	sw.enabled = sw.period != 0 || sw.shift != 0
+	if sw.shift != 0 {
+		if _, overflow := sw.calculate(); overflow {
+			s.enabled = false
+		}
+	}
+}
+
+func (s *square) clockLength() {
+	if s.length.clock() {
+		s.enabled = false
+	}
+}
+
+func (s *square) clockSweep() {
+	sw := s.sweep
+	sw.timer -= 1
+	if sw.timer != 0 {
+		return
+	}
+	sw.reloadTimer()
+	if !sw.enabled || sw.period == 0 {
+		return
+	}
+	freq, overflow := sw.calculate()
+	if overflow {
+		s.enabled = false
+		return
+	}
+	if sw.shift == 0 {
+		return
+	}
+	sw.shadow = freq
+	s.frequency = freq
+	// the new frequency is checked again but not written back
+	if _, overflow := sw.calculate(); overflow {
+		s.enabled = false
+	}
+}
@@ -0,0 +1,105 @@
+package apu
+
+// wave channel, plays 32 4-bit samples from wave RAM (FF30-FF3F)
+type wave struct {
+	enabled    bool
+	dacEnabled bool
+
+	length lengthCounter
+
+	volumeCode byte
+	frequency  uint16
+	timer      int
+	position   byte
+	sample     byte
+
+	ram [16]byte
+}
+
+func (w *wave) state() []interface{} {
+	values := []interface{}{&w.enabled, &w.dacEnabled, &w.volumeCode, &w.frequency, &w.timer, &w.position, &w.sample, &w.ram}
+	return append(values, w.length.state()...)
+}
+
+func newWave() wave {
+	return wave{length: lengthCounter{max: 256}}
+}
+
+func (w *wave) period() int {
+	return (2048 - int(w.frequency)) * 2
+}
+
+func (w *wave) step(t int) {
+	w.timer -= t
+	for w.timer <= 0 {
+		w.timer += w.period()
+		w.position = (w.position + 1) & 0x1F
+		b := w.ram[w.position/2]
+		if w.position%2 == 0 {
+			w.sample = b >> 4
+		} else {
+			w.sample = b & 0x0F
+		}
+	}
+}
+
+func (w *wave) output() byte {
+	if !w.enabled || w.volumeCode == 0 {
+		return 0
+	}
+	return w.sample >> (w.volumeCode - 1)
+}
+
+// while the channel is playing, wave RAM accesses hit the byte that is currently being played
+func (w *wave) ramIndex(index uint16) uint16 {
+	if w.enabled {
+		return uint16(w.position / 2)
+	}
+	return index
+}
+
+func (w *wave) readRam(index uint16) byte {
+	return w.ram[w.ramIndex(index)]
+}
+
+func (w *wave) writeRam(index uint16, val byte) {
+	w.ram[w.ramIndex(index)] = val
+}
+
+func (w *wave) writeDac(val byte) {
+	w.dacEnabled = val&0x80 != 0
+	if !w.dacEnabled {
+		w.enabled = false
+	}
+}
+
+func (w *wave) writeLength(val byte) {
+	w.length.load(val)
+}
+
+func (w *wave) writeVolume(val byte) {
+	w.volumeCode = (val >> 5) & 0x03
+}
+
+func (w *wave) writeFrequencyLow(val byte) {
+	w.frequency = (w.frequency & 0x700) | uint16(val)
+}
+
+func (w *wave) writeFrequencyHigh(val byte, lengthStepNext bool) {
+	w.frequency = (w.frequency & 0xFF) | (uint16(val&0x07) << 8)
+	trigger := val&0x80 != 0
+	if w.length.write(val&0x40 != 0, trigger, lengthStepNext) {
+		w.enabled = false
+	}
+	if trigger {
+		w.enabled = w.dacEnabled
+		w.timer = w.period()
+		w.position = 0
+	}
+}
+
+func (w *wave) clockLength() {
+	if w.length.clock() {
+		w.enabled = false
+	}
+}
@@ -0,0 +1,33 @@
+package go_gb
+
+const (
+	SampleRate44100 = 44100 // Hz
+	SampleRate48000 = 48000 // Hz
+)
+
+// a single stereo PCM frame
+type AudioFrame struct {
+	Left, Right int16
+}
+
+type AudioSink interface {
+	// host sample rate in Hz the frames are resampled to
+	SampleRate() int
+	// receives resampled frames, the slice is reused after the call returns
+	Play(frames []AudioFrame)
+}
+
+type NopAudioSink struct {
+	sampleRate int
+}
+
+func NewNopAudioSink(sampleRate int) *NopAudioSink {
+	return &NopAudioSink{sampleRate: sampleRate}
+}
+
+func (n *NopAudioSink) SampleRate() int {
+	return n.sampleRate
+}
+
+func (n *NopAudioSink) Play(frames []AudioFrame) {
+}
@@ -0,0 +1,143 @@
+package battery
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	go_gb "go-gb"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+const extension = ".sav"
+
+// keeps the battery backed RAM of a cartridge in a .sav file next to the ROM
+type saveFile struct {
+	cartridge go_gb.Battery
+	path      string
+
+	lastSaved []byte
+	mutex     sync.Mutex
+}
+
+func NewSaveFile(cartridge go_gb.Battery, romPath string) *saveFile {
+	return &saveFile{cartridge: cartridge, path: SavePath(romPath)}
+}
+
+// returns the save file path for the ROM, e.g. roms/tetris.gb -> roms/tetris.sav
+func SavePath(romPath string) string {
+	return strings.TrimSuffix(romPath, filepath.Ext(romPath)) + extension
+}
+
+func (s *saveFile) Path() string {
+	return s.path
+}
+
+// loads the save file into the cartridge, a missing save file is not an error
+func (s *saveFile) Load() error {
+	if !s.cartridge.HasBattery() {
+		return nil
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	data, err := ioutil.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if err = s.cartridge.ImportRAM(data); err != nil {
+		return fmt.Errorf("cannot load %s: %w", s.path, err)
+	}
+	s.lastSaved = s.cartridge.ExportRAM()
+	return nil
+}
+
+// writes the cartridge RAM to the save file if it changed since the last flush,
+// the cartridge is read on the calling goroutine so the emulation must not be running
+func (s *saveFile) Flush() error {
+	if !s.cartridge.HasBattery() {
+		return nil
+	}
+	return s.write(s.cartridge.ExportRAM())
+}
+
+func (s *saveFile) write(data []byte) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if bytes.Equal(data, s.lastSaved) {
+		return nil
+	}
+	// write to a temporary file first so a crash mid-write doesn't corrupt the save
+	tmp := s.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return err
+	}
+	s.lastSaved = data
+	return nil
+}
+
+// frame listener that copies the cartridge RAM on the emulation goroutine and writes it on a background goroutine
+type autoSave struct {
+	save     *saveFile
+	interval int
+	frames   int
+
+	snapshots chan []byte
+	done      chan bool
+	once      sync.Once
+}
+
+// writes the save file every given number of frames until Stop is called, the returned listener has to be
+// called after every frame, e.g. by the scheduler
+func (s *saveFile) FlushEvery(frames int, onError func(err error)) *autoSave {
+	a := &autoSave{save: s, interval: frames, snapshots: make(chan []byte, 1), done: make(chan bool)}
+	go func() {
+		defer close(a.done)
+		for data := range a.snapshots {
+			if err := s.write(data); err != nil && onError != nil {
+				onError(err)
+			}
+		}
+	}()
+	return a
+}
+
+func (a *autoSave) Frame() error {
+	if !a.save.cartridge.HasBattery() {
+		return nil
+	}
+	a.frames += 1
+	if a.frames < a.interval {
+		return nil
+	}
+	a.frames = 0
+	data := a.save.cartridge.ExportRAM()
+	select {
+	case a.snapshots <- data:
+	default: // the writer is still busy, replace the pending snapshot
+		select {
+		case <-a.snapshots:
+		default:
+		}
+		a.snapshots <- data
+	}
+	return nil
+}
+
+// waits for the pending snapshot and flushes one last time, the emulation must be stopped
+func (a *autoSave) Stop() error {
+	a.once.Do(func() {
+		close(a.snapshots)
+		<-a.done
+	})
+	return a.save.Flush()
+}
@@ -0,0 +1,106 @@
+package battery
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type mockCartridge struct {
+	ram []byte
+}
+
+func (m *mockCartridge) HasBattery() bool {
+	return true
+}
+
+func (m *mockCartridge) ExportRAM() []byte {
+	return append([]byte(nil), m.ram...)
+}
+
+func (m *mockCartridge) ImportRAM(data []byte) error {
+	copy(m.ram, data)
+	return nil
+}
+
+func TestSavePath(t *testing.T) {
+	if path := SavePath(filepath.Join("roms", "tetris.gb")); path != filepath.Join("roms", "tetris.sav") {
+		t.Errorf("invalid save path %s", path)
+	}
+}
+
+func TestSaveFile_FlushLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "battery")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	romPath := filepath.Join(dir, "game.gb")
+
+	cartridge := &mockCartridge{ram: make([]byte, 4)}
+	save := NewSaveFile(cartridge, romPath)
+	if err = save.Load(); err != nil {
+		t.Fatalf("missing save file should not fail: %v", err)
+	}
+
+	cartridge.ram = []byte{1, 2, 3, 4}
+	if err = save.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(save.Path())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, cartridge.ram) {
+		t.Fatalf("expected %v, got %v", cartridge.ram, data)
+	}
+
+	loaded := &mockCartridge{ram: make([]byte, 4)}
+	if err = NewSaveFile(loaded, romPath).Load(); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(loaded.ram, cartridge.ram) {
+		t.Errorf("expected %v, got %v", cartridge.ram, loaded.ram)
+	}
+}
+
+func TestSaveFile_FlushEvery(t *testing.T) {
+	dir, err := ioutil.TempDir("", "battery")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cartridge := &mockCartridge{ram: make([]byte, 4)}
+	save := NewSaveFile(cartridge, filepath.Join(dir, "game.gb"))
+	autoSave := save.FlushEvery(3, func(err error) {
+		t.Error(err)
+	})
+
+	cartridge.ram = []byte{1, 2, 3, 4}
+	for i := 0; i < 2; i++ {
+		if err := autoSave.Frame(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := os.Stat(save.Path()); !os.IsNotExist(err) {
+		t.Fatalf("expected no save file before the interval, got %v", err)
+	}
+	if err := autoSave.Frame(); err != nil {
+		t.Fatal(err)
+	}
+
+	cartridge.ram = []byte{5, 6, 7, 8}
+	if err := autoSave.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(save.Path())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, cartridge.ram) {
+		t.Errorf("expected the final flush %v, got %v", cartridge.ram, data)
+	}
+}
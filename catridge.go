@@ -1,8 +1,8 @@
 package go_gb
 
 import (
+	"errors"
 	"fmt"
-	"strconv"
 )
 
 const (
@@ -10,6 +10,35 @@ const (
 	KiB = 1 << 10
 )
 
+var (
+	ErrTruncatedROM  = errors.New("ROM is too small to contain a cartridge header")
+	ErrInvalidHeader = errors.New("invalid cartridge header")
+)
+
+// returned for cartridge types without a memory bank controller implementation
+type ErrUnsupportedMapper struct {
+	Type CartridgeType
+}
+
+func (e ErrUnsupportedMapper) Error() string {
+	return fmt.Sprintf("unsupported mapper %s", e.Type.String())
+}
+
+// checks that the ROM can be parsed and its ROM and RAM sizes are known,
+// the mapper is checked when the cartridge is created
+func ValidateRom(rom []byte) error {
+	if len(rom) < int(MemHeaderEnd) {
+		return fmt.Errorf("%w: got %d bytes", ErrTruncatedROM, len(rom))
+	}
+	if romSize := RomSize(rom[CartridgeROMSizeAddr]); !romSize.Valid() {
+		return fmt.Errorf("%w: unknown ROM size %02X", ErrInvalidHeader, byte(romSize))
+	}
+	if ramSize := RamSize(rom[CartridgeRAMSizeAddr]); !ramSize.Valid() {
+		return fmt.Errorf("%w: unknown RAM size %02X", ErrInvalidHeader, byte(ramSize))
+	}
+	return nil
+}
+
 type CartridgeType byte
 
 func (c CartridgeType) String() string {
@@ -71,7 +100,7 @@ func (c CartridgeType) String() string {
 	case MbcHuC1RAMBATTERY:
 		return "HuC1+RAM+BATTERY"
 	}
-	panic("invalid cartridge type " + strconv.Itoa(int(c)))
+	return fmt.Sprintf("unknown (%02X)", byte(c))
 }
 
 const (
@@ -111,6 +140,12 @@ const (
 
 type RomSize byte
 
+func (r RomSize) Valid() bool {
+	size, _ := r.GetSize()
+	return size != 0
+}
+
+// returns the size and the number of banks, 0 for unknown values
 func (r RomSize) GetSize() (uint, uint) {
 	switch r {
 	case 0x00:
@@ -132,16 +167,19 @@ func (r RomSize) GetSize() (uint, uint) {
 	case 0x08:
 		return 8 * MiB, 512
 	case 0x52:
-		return 1100 * KiB, 72
+		return 1152 * KiB, 72
 	case 0x53:
-		return 1200 * KiB, 80
+		return 1280 * KiB, 80
 	case 0x54:
-		return 1500 * KiB, 96
+		return 1536 * KiB, 96
 	}
-	panic("invalid ROM size " + strconv.Itoa(int(r)))
+	return 0, 0
 }
 
 func (r RomSize) String() string {
+	if !r.Valid() {
+		return fmt.Sprintf("unknown (%02X)", byte(r))
+	}
 	size, banks := r.GetSize()
 	var suffix string
 	if banks > 1 || banks == 0 {
@@ -156,6 +194,11 @@ func (r RomSize) String() string {
 
 type RamSize byte
 
+func (r RamSize) Valid() bool {
+	return r <= 0x05
+}
+
+// returns the size and the number of banks, 0 for missing RAM or unknown values
 func (r RamSize) GetSize() (uint, uint) {
 	switch r {
 	case 0x00:
@@ -171,10 +214,13 @@ func (r RamSize) GetSize() (uint, uint) {
 	case 0x05:
 		return 64 * KiB, 8 // 64 KBytes (8 banks of 8KBytes each)
 	}
-	panic("invalid RAM size " + strconv.Itoa(int(r)))
+	return 0, 0
 }
 
 func (r RamSize) String() string {
+	if !r.Valid() {
+		return fmt.Sprintf("unknown (%02X)", byte(r))
+	}
 	size, banks := r.GetSize()
 	var suffix string
 	if banks > 1 || banks == 0 {
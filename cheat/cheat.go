@@ -0,0 +1,168 @@
+package cheat
+
+import (
+	"errors"
+	go_gb "go-gb"
+	"go-gb/memory"
+	"sync"
+	"sync/atomic"
+)
+
+var ErrUnknownCode = errors.New("cheat code is not in the list")
+
+// list of cheat codes, Game Genie codes are applied by the wrapped cartridge and GameShark codes on every frame
+type engine struct {
+	codes []*Code
+	mutex sync.Mutex
+
+	genie atomic.Value // map[uint16][]Code of the enabled Game Genie codes, read on every ROM access
+
+	bus       go_gb.Memory
+	cartridge go_gb.Cartridge
+}
+
+func NewEngine() *engine {
+	e := &engine{}
+	e.update()
+	return e
+}
+
+// memory used for the GameShark writes outside of the external RAM
+func (e *engine) Init(bus go_gb.Memory) {
+	e.bus = bus
+}
+
+// adds an enabled code or updates the description of a code that is already in the list
+func (e *engine) Add(code, description string) (Code, error) {
+	c, err := Parse(code)
+	if err != nil {
+		return Code{}, err
+	}
+	c.Description = description
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	if existing := e.find(c.Code); existing != nil {
+		existing.Description = description
+		return *existing, nil
+	}
+	e.codes = append(e.codes, c)
+	e.update()
+	return *c, nil
+}
+
+func (e *engine) Remove(code string) error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	for i, c := range e.codes {
+		if c.Code == normalize(code) {
+			e.codes = append(e.codes[:i], e.codes[i+1:]...)
+			e.update()
+			return nil
+		}
+	}
+	return ErrUnknownCode
+}
+
+func (e *engine) SetEnabled(code string, enabled bool) error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	c := e.find(normalize(code))
+	if c == nil {
+		return ErrUnknownCode
+	}
+	c.Enabled = enabled
+	e.update()
+	return nil
+}
+
+// returns a copy of all codes in the order they were added
+func (e *engine) Codes() []Code {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	result := make([]Code, len(e.codes))
+	for i, c := range e.codes {
+		result[i] = *c
+	}
+	return result
+}
+
+func (e *engine) find(code string) *Code {
+	for _, c := range e.codes {
+		if c.Code == code {
+			return c
+		}
+	}
+	return nil
+}
+
+// rebuilds the Game Genie lookup, must be called with the mutex held
+func (e *engine) update() {
+	genie := make(map[uint16][]Code)
+	for _, c := range e.codes {
+		if c.Enabled && c.kind == GameGenie {
+			genie[c.address] = append(genie[c.address], *c)
+		}
+	}
+	e.genie.Store(genie)
+}
+
+// returns the value read from the ROM after applying the Game Genie codes
+func (e *engine) substitute(pointer uint16, val byte) byte {
+	for _, c := range e.genie.Load().(map[uint16][]Code)[pointer] {
+		if !c.hasCompare || c.compare == val {
+			return c.value
+		}
+	}
+	return val
+}
+
+// called on every VBlank, applies the GameShark codes
+func (e *engine) Frame() error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	for _, c := range e.codes {
+		if !c.Enabled || c.kind != GameShark {
+			continue
+		}
+		ram, banked := e.cartridge.(memory.BankedRAMCartridge)
+		if banked && memory.ExternalRAMStart <= c.address && c.address <= memory.ExternalRAMEnd {
+			ram.StoreRAM(c.bank, c.address, c.value)
+		} else if e.bus != nil {
+			e.bus.Store(c.address, c.value)
+		}
+	}
+	return nil
+}
+
+// wraps the cartridge so the Game Genie codes replace the bytes read from the ROM
+func (e *engine) Wrap(cartridge go_gb.Cartridge) go_gb.Cartridge {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.cartridge = cartridge
+	return &genie{Cartridge: cartridge, engine: e}
+}
+
+type genie struct {
+	go_gb.Cartridge
+	engine *engine
+}
+
+func (g *genie) Read(pointer uint16) byte {
+	val := g.Cartridge.Read(pointer)
+	if pointer <= memory.ROMBankNEnd {
+		return g.engine.substitute(pointer, val)
+	}
+	return val
+}
+
+func (g *genie) ReadBytes(pointer, n uint16) []byte {
+	data := g.Cartridge.ReadBytes(pointer, n)
+	if pointer > memory.ROMBankNEnd || len(g.engine.genie.Load().(map[uint16][]Code)) == 0 {
+		return data
+	}
+	result := append([]byte(nil), data...) // the cartridge may return its ROM without copying
+	for i, val := range result {
+		result[i] = g.engine.substitute(pointer+uint16(i), val)
+	}
+	return result
+}
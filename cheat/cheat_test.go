@@ -0,0 +1,204 @@
+package cheat
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"path/filepath"
+	"testing"
+)
+
+type mockCartridge struct {
+	rom [0x8000]byte
+	ram map[uint16]byte // bank << 13 | offset
+}
+
+func (m *mockCartridge) ReadBytes(pointer, n uint16) []byte {
+	return m.rom[pointer : pointer+n]
+}
+
+func (m *mockCartridge) Read(pointer uint16) byte {
+	return m.rom[pointer]
+}
+
+func (m *mockCartridge) StoreBytes(pointer uint16, bytes []byte) {
+	panic("implement me")
+}
+
+func (m *mockCartridge) Store(pointer uint16, val byte) {
+	panic("implement me")
+}
+
+func (m *mockCartridge) LoadRom(bytes []byte) int {
+	panic("implement me")
+}
+
+func (m *mockCartridge) HasBattery() bool {
+	panic("implement me")
+}
+
+func (m *mockCartridge) ExportRAM() []byte {
+	panic("implement me")
+}
+
+func (m *mockCartridge) ImportRAM(data []byte) error {
+	panic("implement me")
+}
+
+func (m *mockCartridge) SaveState(w io.Writer) error {
+	panic("implement me")
+}
+
+func (m *mockCartridge) LoadState(r io.Reader) error {
+	panic("implement me")
+}
+
+func (m *mockCartridge) StoreRAM(bank byte, pointer uint16, val byte) {
+	m.ram[uint16(bank)<<13|(pointer-0xA000)] = val
+}
+
+type mockBus map[uint16]byte
+
+func (m mockBus) ReadBytes(pointer, n uint16) []byte {
+	panic("implement me")
+}
+
+func (m mockBus) Read(pointer uint16) byte {
+	panic("implement me")
+}
+
+func (m mockBus) StoreBytes(pointer uint16, bytes []byte) {
+	panic("implement me")
+}
+
+func (m mockBus) Store(pointer uint16, val byte) {
+	m[pointer] = val
+}
+
+func TestParse(t *testing.T) {
+	c, err := Parse("3c1-23b-8ea")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Kind() != GameGenie || c.Address() != 0x4123 || c.Value() != 0x3C || !c.hasCompare || c.compare != 0x18 {
+		t.Errorf("expected Game Genie 4123=3C if 18, got %s %X=%X if %X\n", c.Kind(), c.Address(), c.Value(), c.compare)
+	}
+	if c.Code != "3C1-23B-8EA" {
+		t.Errorf("expected the code in upper case, got %s\n", c.Code)
+	}
+
+	c, err = Parse("010F34D2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Kind() != GameShark || c.Address() != 0xD234 || c.Value() != 0x0F || c.bank != 0x01 {
+		t.Errorf("expected GameShark D234=0F in bank 1, got %s %X=%X in bank %d\n", c.Kind(), c.Address(), c.Value(), c.bank)
+	}
+
+	for _, code := range []string{"", "123", "XYZ-123", "01FF0080", "000-000"} {
+		if _, err := Parse(code); !errors.Is(err, ErrInvalidCode) {
+			t.Errorf("expected %v for %q, got %v\n", ErrInvalidCode, code, err)
+		}
+	}
+}
+
+func TestEngine_GameGenie(t *testing.T) {
+	cartridge := &mockCartridge{}
+	cartridge.rom[0x4123] = 0x18
+	cartridge.rom[0x0150] = 0x42
+	e := NewEngine()
+	wrapped := e.Wrap(cartridge)
+
+	if _, err := e.Add("3C1-23B-8EA", "compare 18"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := e.Add("991-50F", "no compare"); err != nil {
+		t.Fatal(err)
+	}
+	if val := wrapped.Read(0x4123); val != 0x3C {
+		t.Errorf("expected %X, got %X\n", 0x3C, val)
+	}
+	if val := wrapped.Read(0x0150); val != 0x99 {
+		t.Errorf("expected %X, got %X\n", 0x99, val)
+	}
+	if data := wrapped.ReadBytes(0x4122, 2); !bytes.Equal(data, []byte{0x00, 0x3C}) {
+		t.Errorf("expected %X, got %X\n", []byte{0x00, 0x3C}, data)
+	}
+	if cartridge.rom[0x4123] != 0x18 {
+		t.Error("expected the ROM to be unchanged")
+	}
+
+	cartridge.rom[0x4123] = 0x19 // another bank is mapped
+	if val := wrapped.Read(0x4123); val != 0x19 {
+		t.Errorf("expected the compare byte to keep %X, got %X\n", 0x19, val)
+	}
+
+	if err := e.SetEnabled("991-50f", false); err != nil {
+		t.Fatal(err)
+	}
+	if val := wrapped.Read(0x0150); val != 0x42 {
+		t.Errorf("expected a disabled code to keep %X, got %X\n", 0x42, val)
+	}
+	if err := e.Remove("000-000"); !errors.Is(err, ErrUnknownCode) {
+		t.Errorf("expected %v, got %v\n", ErrUnknownCode, err)
+	}
+}
+
+func TestEngine_GameShark(t *testing.T) {
+	cartridge := &mockCartridge{ram: map[uint16]byte{}}
+	bus := mockBus{}
+	e := NewEngine()
+	e.Wrap(cartridge)
+	e.Init(bus)
+	for _, code := range []string{"0163A0C0", "0399FFA1", "01AB10FF"} {
+		if _, err := e.Add(code, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := e.Frame(); err != nil {
+		t.Fatal(err)
+	}
+	if bus[0xC0A0] != 0x63 || bus[0xFF10] != 0xAB {
+		t.Errorf("expected WRAM and HRAM writes, got %v\n", bus)
+	}
+	if val := cartridge.ram[3<<13|0x01FF]; val != 0x99 {
+		t.Errorf("expected %X in external RAM bank 3, got %X\n", 0x99, val)
+	}
+}
+
+func TestEngine_SaveLoad(t *testing.T) {
+	e := NewEngine()
+	if _, err := e.Add("3C1-23B-8EA", "infinite lives"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := e.Add("010F34D2", "max money"); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.SetEnabled("010F34D2", false); err != nil {
+		t.Fatal(err)
+	}
+
+	path := ListPath(t.TempDir(), "POKEMON/RED")
+	if filepath.Base(path) != "POKEMON_RED.cht" {
+		t.Errorf("expected a file name without separators, got %s\n", filepath.Base(path))
+	}
+	if err := e.SaveFile(path); err != nil {
+		t.Fatal(err)
+	}
+	loaded := NewEngine()
+	if err := loaded.LoadFile(path); err != nil {
+		t.Fatal(err)
+	}
+	codes, expected := loaded.Codes(), e.Codes()
+	if len(codes) != len(expected) {
+		t.Fatalf("expected %d codes, got %d\n", len(expected), len(codes))
+	}
+	for i := range codes {
+		if codes[i] != expected[i] {
+			t.Errorf("expected %+v, got %+v\n", expected[i], codes[i])
+		}
+	}
+	if err := NewEngine().LoadFile(filepath.Join(t.TempDir(), "missing.cht")); err != nil {
+		t.Errorf("expected no error for a missing list, got %v\n", err)
+	}
+}
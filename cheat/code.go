@@ -0,0 +1,93 @@
+package cheat
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var ErrInvalidCode = errors.New("invalid cheat code")
+
+type Kind byte
+
+const (
+	GameGenie Kind = iota // replaces bytes read from the ROM
+	GameShark             // writes to RAM every frame
+)
+
+func (k Kind) String() string {
+	if k == GameGenie {
+		return "Game Genie"
+	}
+	return "GameShark"
+}
+
+type Code struct {
+	Code        string // as entered, in upper case
+	Description string
+	Enabled     bool
+
+	kind       Kind
+	address    uint16
+	value      byte
+	compare    byte // Game Genie only, the value is only replaced if the ROM contains this byte
+	hasCompare bool
+	bank       byte // GameShark only, external RAM bank
+}
+
+func (c *Code) Kind() Kind {
+	return c.kind
+}
+
+func (c *Code) Address() uint16 {
+	return c.address
+}
+
+func (c *Code) Value() byte {
+	return c.value
+}
+
+// parses ABC-DEF(-GHI) Game Genie and TTVVLLHH GameShark codes, new codes are enabled
+func Parse(code string) (*Code, error) {
+	code = normalize(code)
+	digits := strings.ReplaceAll(code, "-", "")
+	if _, err := strconv.ParseUint(digits, 16, 64); err != nil {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidCode, code)
+	}
+	nibble := func(i int) uint16 {
+		val, _ := strconv.ParseUint(digits[i:i+1], 16, 8)
+		return uint16(val)
+	}
+
+	c := &Code{Code: code, Enabled: true}
+	switch len(digits) {
+	case 6, 9:
+		c.kind = GameGenie
+		c.value = byte(nibble(0)<<4 | nibble(1))
+		c.address = (nibble(5)<<12 | nibble(2)<<8 | nibble(3)<<4 | nibble(4)) ^ 0xF000
+		if c.address > 0x7FFF {
+			return nil, fmt.Errorf("%w: %q doesn't patch the ROM", ErrInvalidCode, code)
+		}
+		if len(digits) == 9 { // the eighth digit is not used
+			compare := byte(nibble(6)<<4 | nibble(8))
+			c.compare = (compare>>2 | compare<<6) ^ 0xBA
+			c.hasCompare = true
+		}
+	case 8:
+		c.kind = GameShark
+		c.bank = byte(nibble(0)<<4 | nibble(1))
+		c.value = byte(nibble(2)<<4 | nibble(3))
+		c.address = nibble(6)<<12 | nibble(7)<<8 | nibble(4)<<4 | nibble(5)
+		if c.address < 0xA000 {
+			return nil, fmt.Errorf("%w: %q doesn't write to RAM", ErrInvalidCode, code)
+		}
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrInvalidCode, code)
+	}
+	return c, nil
+}
+
+func normalize(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
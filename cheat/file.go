@@ -0,0 +1,97 @@
+package cheat
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+)
+
+const extension = ".cht"
+
+// returns the cheat list path of a game, e.g. cheats/TETRIS.cht
+func ListPath(dir, title string) string {
+	name := strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || r == ' ' || r == '-' || r == '_' {
+			return r
+		}
+		return '_'
+	}, title)
+	if name == "" {
+		name = "untitled"
+	}
+	return filepath.Join(dir, name+extension)
+}
+
+// writes one code per line: the code, 1 or 0 for enabled and the description, separated by tabs
+func (e *engine) Save(w io.Writer) error {
+	for _, c := range e.Codes() {
+		enabled := 0
+		if c.Enabled {
+			enabled = 1
+		}
+		if _, err := fmt.Fprintf(w, "%s\t%d\t%s\n", c.Code, enabled, c.Description); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// adds the codes written by Save
+func (e *engine) Load(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		fields := strings.SplitN(scanner.Text(), "\t", 3)
+		if len(fields) < 2 || (fields[1] != "0" && fields[1] != "1") {
+			return fmt.Errorf("%w: line %d", ErrInvalidCode, line)
+		}
+		var description string
+		if len(fields) == 3 {
+			description = fields[2]
+		}
+		c, err := e.Add(fields[0], description)
+		if err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+		if err := e.SetEnabled(c.Code, fields[1] == "1"); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// loads the cheat list of a game, a missing file is not an error
+func (e *engine) LoadFile(path string) error {
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer file.Close()
+	return e.Load(file)
+}
+
+func (e *engine) SaveFile(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	var sb strings.Builder
+	if err := e.Save(&sb); err != nil {
+		return err
+	}
+	// write to a temporary file first so a crash mid-write doesn't lose the list
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, []byte(sb.String()), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -1,20 +1,65 @@
 package main
 
 import (
+	"bufio"
+	"flag"
 	"fmt"
 	go_gb "go-gb"
+	"go-gb/apu"
+	"go-gb/battery"
+	"go-gb/cheat"
 	"go-gb/cpu"
+	"go-gb/joypad"
 	"go-gb/memory"
+	"go-gb/movie"
+	"go-gb/patch"
 	"go-gb/ppu"
+	"go-gb/rewind"
 	"go-gb/scheduler"
 	"go-gb/serial"
 	"go-gb/timer"
+	"go-gb/wav"
+	"io"
+	"io/ioutil"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
+	"time"
 )
 
+var (
+	romPath    = flag.String("rom", "roms/gb-test-roms-master/cpu_instrs/cpu_instrs.gb", "ROM file to run")
+	patchPath  = flag.String("patch", "", "IPS, UPS or BPS patch applied to the ROM, the ROM file is not modified")
+	cheatsDir  = flag.String("cheats", "", "directory with the cheat lists, named after the game title")
+	wavOutput  = flag.String("wav", "", "write the audio output to a WAV file")
+	sampleRate = flag.Int("rate", go_gb.SampleRate44100, "audio sample rate in Hz")
+	pixelFIFO  = flag.Bool("fifo", false, "render with the pixel FIFO, slower but draws mid-scanline raster effects")
+	rtcCycles  = flag.Bool("rtc-cycles", false, "drive the cartridge clock by the emulated cycles instead of the wall clock")
+	rewindMiB  = flag.Int("rewind", 0, "MiB kept for rewinding, 0 disables it, type r and enter to rewind")
+	rewindBy   = flag.Int("rewind-frames", 180, "frames rewound at once")
+	recordPath = flag.String("record", "", "record the input from power-on to a movie file, written on exit")
+	playPath   = flag.String("play", "", "replay a movie file instead of reading the joypad")
+)
+
+type movieRecorder interface {
+	go_gb.IOJoypad
+	StartFromPowerOn(rom []byte, cartridge go_gb.Battery)
+	Clock() movie.Clock
+	Frame() error
+	Save(w io.Writer) error
+}
+
+type moviePlayer interface {
+	go_gb.IOJoypad
+	Start(rom []byte, cartridge go_gb.Battery, state go_gb.Stateful) error
+	Clock() movie.Clock
+	Frame() error
+}
+
 func main() {
+	flag.Parse()
+
 	logs, err := os.Create("output.log")
 	if err != nil {
 		panic(err)
@@ -22,28 +67,78 @@ func main() {
 	defer logs.Close()
 
 	mmu := memory.NewMMU()
-	file, err := os.Open("roms/gb-test-roms-master/cpu_instrs/cpu_instrs.gb")
+	rom, err := ioutil.ReadFile(*romPath)
 	if err != nil {
 		panic(err)
 	}
-	defer file.Close()
+	if *patchPath != "" {
+		data, err := ioutil.ReadFile(*patchPath)
+		if err != nil {
+			panic(err)
+		}
+		if rom, err = patch.Apply(rom, data); err != nil {
+			panic(err)
+		}
+	}
 
-	game, err := go_gb.LoadGame(file)
+	game, err := go_gb.NewGame(rom)
 	if err != nil {
 		panic(err)
 	}
 
 	fmt.Println(game)
 
-	mmu.Init(game.Rom, go_gb.GB, go_gb.NOPJoypad)
+	input := joypad.NewJoypad()
+	var joypad go_gb.IOJoypad = input
+	var recorder movieRecorder
+	var player moviePlayer
+	if *playPath != "" {
+		movieFile, err := os.Open(*playPath)
+		if err != nil {
+			panic(err)
+		}
+		recording, err := movie.Load(movieFile)
+		movieFile.Close()
+		if err != nil {
+			panic(err)
+		}
+		player = movie.NewPlayer(recording)
+		joypad = player
+	} else if *recordPath != "" {
+		recorder = movie.NewRecorder(input)
+		joypad = recorder
+	}
+	if err := mmu.Init(game.Rom, go_gb.GB, joypad); err != nil {
+		panic(err)
+	}
+	joypad.Init(mmu.IO())
+
+	var listeners []scheduler.FrameListener
+	if player == nil { // a movie replaces the SRAM with its own, it must not end up in the battery save
+		save := battery.NewSaveFile(mmu.Cartridge(), *romPath)
+		if err := save.Load(); err != nil {
+			panic(err)
+		}
+		autoSave := save.FlushEvery(600, func(err error) { // about every 10 seconds
+			fmt.Println("failed saving", save.Path(), err)
+		})
+		defer func() {
+			if err := autoSave.Stop(); err != nil {
+				fmt.Println("failed saving", save.Path(), err)
+			}
+		}()
+		listeners = append(listeners, autoSave)
+	}
 
 	lcd := go_gb.NewNopDisplay()
 
-	divTimer := timer.NewDivTimer(mmu.IO())
 	timer := timer.NewTimer(mmu.IO())
+	mmu.SetTimer(timer)
 
 	//mmuD := memory.NewDebugger(mmu, os.Stdout)
-	ppu := ppu.NewPpu(mmu, mmu.VRAM(), mmu.OAM(), mmu.IO(), lcd)
+	ppu := ppu.NewPpu(mmu, mmu.VRAM(), mmu.OAM(), mmu.IO(), lcd, go_gb.GB)
+	ppu.UseFIFO(*pixelFIFO)
+	mmu.SetLCD(ppu)
 	mmuD := memory.NewDebugger(mmu, logs)
 	mmuD.Debug(false)
 
@@ -54,7 +149,45 @@ func main() {
 
 	serialPort := serial.NewSerial(serial.NopSerial, nil, serialFile, mmu.IO())
 
-	realCpu := cpu.NewCpu(mmuD, ppu, timer, divTimer, serialPort)
+	spu := apu.NewApu(mmu.IO())
+	mmu.SetSPU(spu)
+
+	closeAudio := func() {}
+	if *wavOutput != "" {
+		wavFile, err := os.Create(*wavOutput)
+		if err != nil {
+			panic(err)
+		}
+		sink, err := wav.NewFileSink(wavFile, *sampleRate)
+		if err != nil {
+			panic(err)
+		}
+		spu.SetSink(sink)
+		closeAudio = func() {
+			if err := sink.Close(); err != nil {
+				fmt.Println("failed writing the WAV file", err)
+			}
+			wavFile.Close()
+		}
+	}
+	defer closeAudio()
+
+	realCpu := cpu.NewCpu(mmuD, ppu, timer, serialPort, spu, joypad)
+	if rtc, ok := mmu.Cartridge().(memory.RTCCartridge); ok && *rtcCycles {
+		clock := memory.NewCycleClock(time.Now())
+		rtc.SetTimeSource(clock)
+		realCpu.SetClock(clock)
+	}
+	machineState := go_gb.StatefulGroup{realCpu, mmu, ppu, timer, serialPort, spu}
+	if player != nil {
+		if err := player.Start(game.Rom, mmu.Cartridge(), machineState); err != nil {
+			panic(err)
+		}
+		realCpu.SetClock(player.Clock())
+	} else if recorder != nil {
+		recorder.StartFromPowerOn(game.Rom, mmu.Cartridge())
+		realCpu.SetClock(recorder.Clock())
+	}
 
 	debugger := cpu.NewDebugger(realCpu, logs, cpu.NewInstructionQueue(100000))
 	debugger.PrintEveryCycle = false
@@ -63,6 +196,9 @@ func main() {
 
 	defer func() {
 		err := recover()
+		if err == nil {
+			return
+		}
 		switch err.(type) {
 		case error:
 			fmt.Printf("PC: %X -> err: %v\n", realCpu.PC(), err)
@@ -78,16 +214,61 @@ func main() {
 
 	sched := scheduler.NewScheduler(debugger, ppu, lcd)
 	sched.Throttle = false
+	sched.Listeners = append(sched.Listeners, listeners...)
+	if player != nil {
+		sched.Listeners = append(sched.Listeners, player)
+	} else if recorder != nil {
+		sched.Listeners = append(sched.Listeners, recorder)
+	}
+	if *cheatsDir != "" {
+		cheats := cheat.NewEngine()
+		if err := cheats.LoadFile(cheat.ListPath(*cheatsDir, game.Title)); err != nil {
+			panic(err)
+		}
+		mmu.WrapCartridge(cheats.Wrap(mmu.Cartridge()))
+		cheats.Init(mmu)
+		sched.Listeners = append(sched.Listeners, cheats)
+	}
+	if *rewindMiB > 0 {
+		config := rewind.DefaultConfig
+		config.MaxBytes = *rewindMiB << 20
+		sched.Rewinder = rewind.NewBuffer(machineState, config)
+		go func() {
+			input := bufio.NewScanner(os.Stdin)
+			for input.Scan() {
+				if strings.TrimSpace(input.Text()) == "r" {
+					sched.Rewind(*rewindBy)
+				}
+			}
+		}()
+	}
 	//sched.AddStopper(0x100)
 
 	go func() {
 		fmt.Println("waiting for the signal", os.Getpid())
 		signal := <-sig
 		fmt.Println("received a signal", signal.String())
-		debugger.Dump()
-		fmt.Println("dumped instr queue")
-		os.Exit(0)
+		sched.Stop() // the save is flushed once the emulation stopped
 	}()
 
 	sched.Run()
+	debugger.Dump()
+	fmt.Println("dumped instr queue")
+	if recorder != nil {
+		if err := saveMovie(recorder, *recordPath); err != nil {
+			fmt.Println("failed writing the movie", *recordPath, err)
+		}
+	}
+}
+
+func saveMovie(recorder movieRecorder, path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := recorder.Save(file); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
 }
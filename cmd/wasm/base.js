@@ -33,6 +33,11 @@ worker.onmessage = ev => {
         case 'vram':
             document.getElementById('vram').innerText = ev.data.msg;
             break;
+        case 'rumble':
+            if (navigator.vibrate) {
+                navigator.vibrate(ev.data.msg ? 60000 : 0);
+            }
+            break;
         case 'custom_palette':
             for (let i = 0; i < 4; i++) {
                 let value = "#" + ev.data.msg[i].slice(0, 3).map(e => e.toString(16).toUpperCase()).join("");
@@ -45,7 +50,20 @@ document.getElementById('rom').addEventListener('change', function () {
     var reader = new FileReader();
     reader.onload = function () {
         document.rom = new Uint8Array(this.result);
-        worker.postMessage({type: 'run', msg: document.rom});
+        worker.postMessage({type: 'run', msg: document.rom, patch: document.patch});
+    }
+    reader.readAsArrayBuffer(this.files[0]);
+}, false);
+
+// patches are applied when the game is loaded, the stored ROM is never modified
+document.getElementById('patch').addEventListener('change', function () {
+    if (this.files.length === 0) {
+        document.patch = null;
+        return;
+    }
+    var reader = new FileReader();
+    reader.onload = function () {
+        document.patch = new Uint8Array(this.result);
     }
     reader.readAsArrayBuffer(this.files[0]);
 }, false);
@@ -73,6 +91,13 @@ function setup(game) {
     } else {
         document.getElementById('non-japanese').innerText = 'Japanese';
     }
+    document.getElementById('licensee').innerText = 'Licensee: ' + game.licensee;
+    document.getElementById('manufacturer').innerText = game.manufacturer ? 'Manufacturer: ' + game.manufacturer : '';
+    document.getElementById('version').innerText = 'Version: ' + game.version;
+    document.getElementById('headerChecksum').innerText = 'Header checksum: ' + game.headerChecksum;
+    document.getElementById('globalChecksum').innerText = 'Global checksum: ' + game.globalChecksum;
+    document.getElementById('logo').innerText = game.logoValid ? 'Valid logo' : 'Invalid logo';
+    document.getElementById('fileSize').innerText = game.sizeValid ? '' : 'File size does not match the ROM size';
 }
 
 function draw() {
@@ -7,7 +7,7 @@ function loadRom(name) {
     req.onsuccess = ev => {
         document.rom = ev.target.result;
         console.log(`loaded ${name}`);
-        worker.postMessage({type: 'run', msg: document.rom});
+        worker.postMessage({type: 'run', msg: document.rom, patch: document.patch});
     }
     req.onerror = console.error;
 }
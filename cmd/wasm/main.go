@@ -4,8 +4,10 @@ import (
 	"bytes"
 	"fmt"
 	go_gb "go-gb"
+	"go-gb/apu"
 	"go-gb/cpu"
 	"go-gb/memory"
+	"go-gb/patch"
 	"go-gb/ppu"
 	"go-gb/scheduler"
 	"go-gb/serial"
@@ -21,13 +23,28 @@ func run() (go_gb.Cpu, go_gb.MemoryBus, go_gb.PPU, go_gb.Display, wasm.Joypad) {
 	mmu := memory.NewMMU()
 	rom := make([]byte, 2*1<<20)
 	n := js.CopyBytesToGo(rom, js.Global().Get("rom"))
+	rom = rom[:n]
+	if patchData := js.Global().Get("patch"); patchData.Truthy() { // soft patching, the stored ROM stays untouched
+		data := make([]byte, patchData.Length())
+		js.CopyBytesToGo(data, patchData)
+		patched, err := patch.Apply(rom, data)
+		if err != nil {
+			panic(err)
+		}
+		rom = patched
+	}
 
 	joypad := wasm.NewJoypad() // todo: fix this relationship
 
-	mmu.Init(rom[:n], go_gb.GB, joypad)
+	if err := mmu.Init(rom, go_gb.GB, joypad); err != nil {
+		panic(err)
+	}
 	joypad.Init(mmu.IO())
+	if cartridge, ok := mmu.Cartridge().(go_gb.RumbleCartridge); ok {
+		cartridge.SubscribeRumble(wasm.NewRumble())
+	}
 
-	game, err := go_gb.LoadGame(ioutil.NopCloser(bytes.NewBuffer(rom[:n])))
+	game, err := go_gb.LoadGame(ioutil.NopCloser(bytes.NewBuffer(rom)))
 	if err != nil {
 		panic(err)
 	}
@@ -38,18 +55,31 @@ func run() (go_gb.Cpu, go_gb.MemoryBus, go_gb.PPU, go_gb.Display, wasm.Joypad) {
 	js.Global().Set("romSize", game.RomSize.String())
 	js.Global().Set("ramSize", game.RamSize.String())
 	js.Global().Set("nonJapanese", game.NonJapanese)
+	js.Global().Set("licensee", game.Licensee)
+	js.Global().Set("manufacturer", game.ManufacturerCode)
+	js.Global().Set("version", int(game.Version))
+	js.Global().Set("headerChecksum", game.HeaderChecksum.String())
+	js.Global().Set("headerChecksumValid", game.HeaderChecksum.Valid())
+	js.Global().Set("globalChecksum", game.GlobalChecksum.String())
+	js.Global().Set("globalChecksumValid", game.GlobalChecksum.Valid())
+	js.Global().Set("logoValid", game.LogoValid)
+	js.Global().Set("sizeValid", game.SizeValid)
 
 	fmt.Println("initialized mmu")
 
 	lcd := wasm.NewWasmDisplay()
 
-	divTimer := timer.NewDivTimer(mmu.IO())
 	timer := timer.NewTimer(mmu.IO())
+	mmu.SetTimer(timer)
 
 	serialPort := serial.NewSerial(nil, nil, nil, mmu.IO())
 
-	ppu := ppu.NewPpu(mmu, mmu.VRAM(), mmu.OAM(), mmu.IO(), lcd)
-	c := cpu.NewCpu(mmu, ppu, timer, divTimer, serialPort)
+	spu := apu.NewApu(mmu.IO())
+	mmu.SetSPU(spu)
+
+	ppu := ppu.NewPpu(mmu, mmu.VRAM(), mmu.OAM(), mmu.IO(), lcd, go_gb.GB)
+	mmu.SetLCD(ppu)
+	c := cpu.NewCpu(mmu, ppu, timer, serialPort, spu, joypad)
 	//c.Debug(true)
 
 	return c, mmu, ppu, lcd, joypad
@@ -1,6 +1,7 @@
 self.importScripts('wasm_exec.js', 'wasm.js', 'colorpalette.js');
 
 var rom
+var patch = null
 var buffer = new Uint8ClampedArray(160 * 144);
 var imageData = new Uint8ClampedArray(160 * 144 * 4);
 
@@ -27,8 +28,13 @@ function draw() {
     imageData = new Uint8ClampedArray(160 * 144 * 4);
 }
 
-function runGame(data) {
+function rumble(on) {
+    self.postMessage({msg: on, type: 'rumble'});
+}
+
+function runGame(data, patchData) {
     rom = data;
+    patch = patchData || null;
     run();
     self.postMessage({
         msg:
@@ -40,6 +46,15 @@ function runGame(data) {
                 romSize: romSize,
                 ramSize: ramSize,
                 nonJapanese: nonJapanese,
+                licensee: licensee,
+                manufacturer: manufacturer,
+                version: version,
+                headerChecksum: headerChecksum,
+                headerChecksumValid: headerChecksumValid,
+                globalChecksum: globalChecksum,
+                globalChecksumValid: globalChecksumValid,
+                logoValid: logoValid,
+                sizeValid: sizeValid,
             }, type: 'game'
     })
 }
@@ -51,7 +66,7 @@ self.onmessage = ev => {
         console.log('running ', ev.data.type);
         switch (ev.data.type) {
             case 'run':
-                runGame(ev.data.msg);
+                runGame(ev.data.msg, ev.data.patch);
                 break;
             case 'start':
                 start();
@@ -2,6 +2,7 @@ package cpu
 
 import (
 	"go-gb"
+	"io"
 	"reflect"
 	"runtime"
 )
@@ -16,6 +17,8 @@ const (
 	PrefixDD byte = 0xDD
 	PrefixED byte = 0xED
 	PrefixFD byte = 0xFD
+
+	dmaDuration go_gb.MC = 160 // OAM DMA copies a byte per machine cycle
 )
 
 // executes specific things on the cpu and returns the number of m cycles it took to execute
@@ -40,21 +43,28 @@ type cpu struct {
 	ier    go_gb.Memory // used for direct register access
 
 	halt      bool
+	haltBug   bool // the next opcode fetch doesn't increment PC
 	stop      bool
 	eiWaiting byte
-	diWaiting byte
 	ime       bool // Interrupt master enable
 	dmaCycles go_gb.MC
+	ticks     go_gb.MC // machine cycles the other components were advanced by in the current step
+
+	doubleSpeed bool // CGB double speed mode, the PPU and APU are stepped every other cycle
+	slowCycle   bool // the PPU and APU are due in double speed mode
+	speedSwitch bool // the timer is held while the speed is switched
 
-	divTimer timer
-	timer    timer
+	timer timer
+	clock timer // stepped at normal speed, e.g. the cartridge RTC
 
 	serial go_gb.Serial
 
-	ppu go_gb.PPU
+	ppu    go_gb.PPU
+	spu    go_gb.SPU
+	joypad go_gb.Joypad
 }
 
-func NewCpu(mmu go_gb.MemoryBus, ppu go_gb.PPU, timer timer, divTimer timer, serial go_gb.Serial) *cpu {
+func NewCpu(mmu go_gb.MemoryBus, ppu go_gb.PPU, timer timer, serial go_gb.Serial, spu go_gb.SPU, joypad go_gb.Joypad) *cpu {
 	c := &cpu{
 		memory:   mmu,
 		ppu:      ppu,
@@ -62,18 +72,63 @@ func NewCpu(mmu go_gb.MemoryBus, ppu go_gb.PPU, timer timer, divTimer timer, ser
 		io:       mmu.IO(),
 		ier:      mmu.InterruptEnableRegister(),
 		timer:    timer,
-		divTimer: divTimer,
 		serial:   serial,
+		spu:      spu,
+		joypad:   joypad,
 	}
 	c.init()
 	return c
 }
 
+// steps the clock by the machine cycles of the normal speed mode, in double speed mode it's stepped every other cycle
+func (c *cpu) SetClock(clock timer) {
+	c.clock = clock
+}
+
 func (c *cpu) IME() bool {
 	return c.ime
 }
 
+// advances the rest of the machine by a single machine cycle, every memory access and
+// internal cycle of an instruction ticks before it happens so the accesses see the hardware state of their cycle
+func (c *cpu) tick() {
+	c.ticks += 1
+	if c.memory.DMAInProgress() {
+		c.dmaCycles += 1
+		if c.dmaCycles >= dmaDuration {
+			c.dmaCycles = 0
+			c.memory.SetDMAInProgress(false)
+			go_gb.Events.Add("DMA done")
+		}
+	}
+	if !c.speedSwitch {
+		c.timer.Step(1)
+	}
+
+	c.serial.Step(1)
+	c.joypad.Step(1)
+
+	if c.doubleSpeed {
+		c.slowCycle = !c.slowCycle
+		if !c.slowCycle {
+			return
+		}
+	}
+	c.spu.Step(1)
+	if c.clock != nil {
+		c.clock.Step(1)
+	}
+	c.ppu.Step(1) // also steps while the LCD is off to notice it being turned on or off
+}
+
+// an internal cycle of an instruction that doesn't access the memory
+func (c *cpu) internal(mc *go_gb.MC) {
+	c.tick()
+	*mc += 1
+}
+
 func (c *cpu) readOpcode(mc *go_gb.MC) byte {
+	c.tick()
 	val := c.memory.Read(c.pc)
 	*mc += 1 // we purposefully don't check for nil in mc because it should always be cycle counted
 	// discard the result if you want not to count cycles.
@@ -82,28 +137,33 @@ func (c *cpu) readOpcode(mc *go_gb.MC) byte {
 }
 
 func (c *cpu) readBytes(pointer, n uint16, mc *go_gb.MC) []byte {
-	*mc += go_gb.MC(n)
-	return c.memory.ReadBytes(pointer, n)
+	result := make([]byte, n)
+	for i := range result {
+		result[i] = c.read(pointer+uint16(i), mc)
+	}
+	return result
 }
 
 func (c *cpu) read(pointer uint16, mc *go_gb.MC) byte {
+	c.tick()
 	*mc += 1
 	return c.memory.Read(pointer)
 }
 
 func (c *cpu) storeBytes(pointer uint16, b []byte, mc *go_gb.MC) {
-	*mc += go_gb.MC(len(b))
-	c.memory.StoreBytes(pointer, b)
+	for i, val := range b {
+		c.store(pointer+uint16(i), val, mc)
+	}
 }
 
 func (c *cpu) store(pointer uint16, val byte, mc *go_gb.MC) {
+	c.tick()
 	*mc += go_gb.MC(1)
 	c.memory.Store(pointer, val)
 }
 
 func (c *cpu) readFromPc(size uint16, mc *go_gb.MC) []byte {
-	val := c.memory.ReadBytes(c.pc, size)
-	*mc += go_gb.MC(size)
+	val := c.readBytes(c.pc, size, mc)
 	c.pc += size
 	return val
 }
@@ -111,17 +171,15 @@ func (c *cpu) readFromPc(size uint16, mc *go_gb.MC) []byte {
 func (c *cpu) setPc(val uint16, mc *go_gb.MC) {
 	c.pc = val
 	if mc != nil {
-		*mc += 1
+		c.internal(mc)
 	}
 }
 
 func (c *cpu) popStack(size int, mc *go_gb.MC) []byte {
 	bytes := make([]byte, size)
 	for i := 0; i < size; i++ {
-		v := c.memory.Read(c.sp)
+		bytes[i] = c.read(c.sp, mc)
 		c.sp += 1
-		*mc += 1
-		bytes[i] = v
 	}
 	return bytes
 }
@@ -129,8 +187,7 @@ func (c *cpu) popStack(size int, mc *go_gb.MC) []byte {
 func (c *cpu) pushStack(b []byte, mc *go_gb.MC) {
 	for i := len(b) - 1; i >= 0; i-- {
 		c.sp -= 1
-		c.memory.Store(c.sp, b[i])
-		*mc += 1
+		c.store(c.sp, b[i], mc)
 	}
 }
 
@@ -155,6 +212,52 @@ func (c *cpu) init() {
 	}
 }
 
+func (c *cpu) state() []interface{} {
+	return []interface{}{&c.pc, &c.sp, &c.r, &c.halt, &c.stop, &c.eiWaiting, &c.ime, &c.dmaCycles, &c.haltBug, &c.doubleSpeed, &c.slowCycle}
+}
+
+func (c *cpu) SaveState(w io.Writer) error {
+	return go_gb.WriteState(w, c.state()...)
+}
+
+func (c *cpu) LoadState(r io.Reader) error {
+	return go_gb.ReadState(r, c.state()...)
+}
+
+// registers and execution state as stored by other emulators' save states
+type Registers struct {
+	PC, SP, AF, BC, DE, HL uint16
+	IME, Halt, Stop        bool
+}
+
+func (c *cpu) Registers() Registers {
+	return Registers{
+		PC: c.pc, SP: c.sp,
+		AF: go_gb.FromBytes(c.af), BC: go_gb.FromBytes(c.bc), DE: go_gb.FromBytes(c.de), HL: go_gb.FromBytes(c.hl),
+		IME: c.ime, Halt: c.halt, Stop: c.stop,
+	}
+}
+
+// replaces the registers, a pending EI and DMA timing are cleared
+func (c *cpu) SetRegisters(r Registers) {
+	c.pc = r.PC
+	c.sp = r.SP
+	copy(c.af, go_gb.ToBytes(r.AF&0xFFF0, true))
+	copy(c.bc, go_gb.ToBytes(r.BC, true))
+	copy(c.de, go_gb.ToBytes(r.DE, true))
+	copy(c.hl, go_gb.ToBytes(r.HL, true))
+	c.ime = r.IME
+	c.halt = r.Halt
+	c.stop = r.Stop
+	c.eiWaiting = 0
+	c.dmaCycles = 0
+	c.haltBug = false
+}
+
+func (c *cpu) DoubleSpeed() bool {
+	return c.doubleSpeed
+}
+
 func (c *cpu) PC() uint16 {
 	return c.pc
 }
@@ -172,6 +275,7 @@ var opcodes = map[uint16]bool{}
 //
 func (c *cpu) Step() go_gb.MC {
 	var cycles go_gb.MC
+	c.ticks = 0
 	//if (c.pc == 0x1b05) && c.memory.Booted() {
 	//	vramFile, err := os.Create("vram.txt")
 	//	if err != nil {
@@ -195,11 +299,19 @@ func (c *cpu) Step() go_gb.MC {
 	//if c.pc == 0x100 {
 	//	print()
 	//}
+	if c.stop && c.memory.Read(go_gb.JOYP)&0x0F != 0x0F {
+		c.stop = false // a selected button is held
+	}
 	if !c.halt && !c.stop {
 		opcode := c.readOpcode(&cycles)
+		if c.haltBug {
+			c.haltBug = false
+			c.pc -= 1
+		}
 		var instr Instr
 		if opcode == 0xCB {
-			opcode = c.readOpcode(&cycles)
+			var fetch go_gb.MC // the prefixed instructions count the fetch of their opcode
+			opcode = c.readOpcode(&fetch)
 			opcodes[uint16(opcode)|0xCB00] = true
 			instr = cbOptable[opcode]
 		} else {
@@ -223,81 +335,73 @@ func (c *cpu) Step() go_gb.MC {
 		*/
 		cycles += instr(c)
 	} else {
-		cycles = 1
+		c.internal(&cycles)
 	}
-	if c.memory.DMAInProgress() {
-		c.dmaCycles += cycles
-		if c.dmaCycles >= 40 {
-			c.dmaCycles = 0
-			c.memory.SetDMAInProgress(false)
-			go_gb.Events.Add("DMA done")
-		}
-	}
-	c.timer.Step(cycles)
-	c.divTimer.Step(cycles)
-
-	c.serial.Step(cycles)
-
-	if c.ppu.Enabled() {
-		c.ppu.Step(cycles)
-		//go_gb.Events.Add("stepped through PPU")
+	for c.ticks < cycles { // trailing internal cycles of the instruction
+		c.tick()
 	}
-	c.handleEiDi()
+	c.handleEi()
 	cycles += c.handleInterrupts()
 	//go_gb.Events.Add("stepped through CPU")
 	return cycles
 }
 
-func (c *cpu) handleInterrupts() go_gb.MC { // todo: should we count the cycles from the memory read?
-	var cycles go_gb.MC
-	if !c.ime { // interrupt master disabled
-		return cycles
-	}
-	ifRegister := c.io.Read(go_gb.IF)
-	ieRegister := c.ier.Read(go_gb.IE)
-
-	//cycles += 2
+// interrupts that are both requested and enabled
+func (c *cpu) pendingInterrupts() byte {
+	return c.io.Read(go_gb.IF) & c.ier.Read(go_gb.IE) & 0x1F
+}
 
-	if ifRegister == 0 { // no interrupt flags set
-		return cycles
+func (c *cpu) handleInterrupts() go_gb.MC {
+	if c.halt && c.pendingInterrupts() != 0 { // halt is exited even when the interrupt isn't serviced
+		c.halt = false
 	}
-
-	for _, interrupt := range go_gb.Interrupts {
-		if go_gb.ShouldServiceInterrupt(ieRegister, ifRegister, interrupt.Bit) {
-			cycles += c.serviceInterrupt(ifRegister, interrupt)
-			c.halt = false
-			return cycles
-		}
+	if !c.ime || c.pendingInterrupts() == 0 {
+		return 0
 	}
-	return cycles
+	return c.serviceInterrupt()
 }
 
-func (c *cpu) serviceInterrupt(ifR byte, interrupt go_gb.Interrupt) go_gb.MC {
+// dispatches the pending interrupt with the highest priority in 5 machine cycles, the interrupt is chosen
+// after the high byte of PC is pushed so a push onto IE can cancel the dispatch, which then jumps to 0x0000
+func (c *cpu) serviceInterrupt() go_gb.MC {
 	var cycles go_gb.MC
-	go_gb.Set(&ifR, int(interrupt.Bit), false)
 	c.ime = false
-	c.io.Store(go_gb.IF, ifR)
-	callAddr(c, go_gb.ToBytes(interrupt.JpAddr, true), &cycles)
-	if interrupt.Bit == go_gb.BitJoypad {
-		c.stop = false // joypad interrupt removed stop
+	c.internal(&cycles) // two wait states
+	c.internal(&cycles)
+
+	pcBytes := go_gb.ToBytes(c.pc, true)
+	c.pushStack(pcBytes[1:], &cycles)
+	pending := c.pendingInterrupts()
+	c.pushStack(pcBytes[:1], &cycles)
+
+	c.pc = 0x0000
+	for _, interrupt := range go_gb.Interrupts {
+		if pending&(1<<interrupt.Bit) == 0 {
+			continue
+		}
+		go_gb.Update(c.io, go_gb.IF, func(b byte) byte {
+			go_gb.Set(&b, int(interrupt.Bit), false)
+			return b
+		})
+		c.pc = interrupt.JpAddr
+		if interrupt.Bit == go_gb.BitJoypad {
+			c.stop = false // joypad interrupt removed stop
+		}
+		//go_gb.Events.Add("serviced an interrupt " + interrupt.String())
+		break
 	}
-	//go_gb.Events.Add("serviced an interrupt " + interrupt.String())
-	return 5
+	c.internal(&cycles) // loading the vector into PC
+	return cycles
 }
 
-func (c *cpu) handleEiDi() {
+// IME is set after the instruction following EI
+func (c *cpu) handleEi() {
 	if c.eiWaiting != 0 {
 		c.eiWaiting -= 1
 		if c.eiWaiting == 0 {
 			c.ime = true
 		}
 	}
-	if c.diWaiting != 0 {
-		c.diWaiting -= 1
-		if c.diWaiting == 0 {
-			c.ime = false
-		}
-	}
 }
 
 func (c *cpu) setFlag(bit int, val bool) {
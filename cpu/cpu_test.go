@@ -11,11 +11,10 @@ type mock struct {
 }
 
 func (m mock) Step(mc go_gb.MC) {
-	panic("implement me")
 }
 
 func (m mock) Enabled() bool {
-	panic("implement me")
+	return false
 }
 
 func (m mock) Mode() byte {
@@ -30,13 +29,26 @@ func (m mock) Stream() io.Reader {
 	panic("implement me")
 }
 
+func (m mock) ReadBytes(pointer, n uint16) []byte {
+	panic("implement me")
+}
+
+func (m mock) Read(pointer uint16) byte {
+	panic("implement me")
+}
+
+func (m mock) StoreBytes(pointer uint16, bytes []byte) {
+	panic("implement me")
+}
+
+func (m mock) Store(pointer uint16, val byte) {
+	panic("implement me")
+}
+
 func initCpu(fill map[uint16]byte) *cpu {
 	mmu := memory.NewMMU()
 	mmu.SetBooted(true)
 
-	mock := &mock{}
-	c := NewCpu(mmu, mock, mock, mock, mock)
-	c.sp = 0xFFFE
 	bytes := make([]byte, 0xFFFF+1)
 	if fill != nil {
 		for addr, val := range fill {
@@ -46,7 +58,12 @@ func initCpu(fill map[uint16]byte) *cpu {
 	bytes[go_gb.CartridgeTypeAddr] = byte(go_gb.MbcROMRAM)
 	bytes[go_gb.CartridgeROMSizeAddr] = 0x05
 	bytes[go_gb.CartridgeRAMSizeAddr] = 0x03
-	mmu.Init(bytes, go_gb.GB, go_gb.NOPJoypad)
+	if err := mmu.Init(bytes, go_gb.GB, go_gb.NOPJoypad); err != nil {
+		panic(err)
+	}
+	mock := &mock{}
+	c := NewCpu(mmu, mock, mock, mock, mock, mock)
+	c.sp = 0xFFFE
 	return c
 }
 
@@ -180,3 +197,222 @@ func TestCpu_Step_NOP(t *testing.T) {
 		t.Errorf("expected PC %X, got %X\n", startPC+1, c.pc)
 	}
 }
+
+// component counting the machine cycles it was stepped by
+type counter struct {
+	mock
+	cycles go_gb.MC
+}
+
+func (c *counter) Step(mc go_gb.MC) {
+	c.cycles += mc
+}
+
+func TestCpu_Step_Ticks(t *testing.T) {
+	program := []byte{
+		0x00,             // NOP
+		0x01, 0x34, 0x12, // LD BC,$1234
+		0xC5,             // PUSH BC
+		0x21, 0x00, 0xC0, // LD HL,$C000
+		0xCB, 0x46, // BIT 0,(HL)
+		0xCB, 0xC6, // SET 0,(HL)
+		0x07,             // RLCA
+		0xCD, 0x20, 0x01, // CALL $0120
+		0xC1, // POP BC
+	}
+	fill := map[uint16]byte{0x0120: 0xC9} // RET
+	for i, b := range program {
+		fill[0x0100+uint16(i)] = b
+	}
+	c := initCpu(fill)
+	c.pc = 0x0100
+	timer := &counter{}
+	c.timer = timer
+
+	expected := []go_gb.MC{1, 3, 4, 3, 3, 4, 1, 6, 4, 3}
+	for i, e := range expected {
+		before := timer.cycles
+		mc := c.Step()
+		if mc != e {
+			t.Errorf("step %d expected %d cycles, got %d\n", i, e, mc)
+		}
+		if ticked := timer.cycles - before; ticked != mc {
+			t.Errorf("step %d expected the timer to be stepped by %d, got %d\n", i, mc, ticked)
+		}
+	}
+}
+
+func TestCpu_Halt_WakesWithoutIME(t *testing.T) {
+	c := initCpu(map[uint16]byte{0x0100: 0x76, 0x0101: 0x3C}) // HALT, INC A
+	c.pc = 0x0100
+	c.ier.Store(go_gb.IE, 0x04)
+
+	c.Step()
+	c.Step()
+	if !c.halt || c.pc != 0x0101 {
+		t.Fatalf("expected the cpu to be halted on %X, got %X\n", 0x0101, c.pc)
+	}
+	c.io.Store(go_gb.IF, 0x04)
+	c.Step() // wakes up
+	c.Step()
+	if c.halt {
+		t.Fatal("expected the cpu to leave halt")
+	}
+	if c.r[go_gb.A] != 1 {
+		t.Errorf("expected %X, got %X\n", 1, c.r[go_gb.A])
+	}
+	if c.io.Read(go_gb.IF) != 0x04 {
+		t.Error("interrupt shouldn't be serviced with IME cleared")
+	}
+}
+
+func TestCpu_Halt_Bug(t *testing.T) {
+	c := initCpu(map[uint16]byte{0x0100: 0x76, 0x0101: 0x3C, 0x0102: 0x00}) // HALT, INC A, NOP
+	c.pc = 0x0100
+	c.ier.Store(go_gb.IE, 0x04)
+	c.io.Store(go_gb.IF, 0x04)
+
+	c.Step()
+	if c.halt {
+		t.Fatal("cpu shouldn't halt with a pending interrupt")
+	}
+	c.Step()
+	c.Step()
+	if c.r[go_gb.A] != 2 {
+		t.Errorf("expected INC A to run twice, A is %X\n", c.r[go_gb.A])
+	}
+	if c.pc != 0x0102 {
+		t.Errorf("expected PC %X, got %X\n", 0x0102, c.pc)
+	}
+}
+
+func TestCpu_Stop(t *testing.T) {
+	c := initCpu(map[uint16]byte{0x0100: 0x10}) // STOP
+	c.pc = 0x0100
+	c.io.Store(go_gb.DIV, 0xAB)
+
+	c.Step()
+	if !c.stop {
+		t.Error("expected the cpu to be stopped")
+	}
+	if div := c.io.Read(go_gb.DIV); div != 0 {
+		t.Errorf("expected DIV %X, got %X\n", 0, div)
+	}
+}
+
+func TestCpu_Stop_SpeedSwitch(t *testing.T) {
+	c := initCpu(map[uint16]byte{0x0100: 0x10, 0x0105: 0x10}) // STOP, 4 NOPs, STOP
+	c.pc = 0x0100
+	timer, spu, clock := &counter{}, &counter{}, &counter{}
+	c.timer, c.spu = timer, spu
+	c.SetClock(clock)
+
+	c.io.Store(go_gb.KEY1, 0x01)
+	if mc := c.Step(); mc != 1+speedSwitchDuration || timer.cycles != 1 {
+		t.Errorf("expected the switch to take %d cycles with the timer held, got %d and a timer stepped by %d\n",
+			1+speedSwitchDuration, mc, timer.cycles)
+	}
+	if c.stop || !c.doubleSpeed {
+		t.Fatal("expected the cpu to switch to double speed")
+	}
+	if key1 := c.io.Read(go_gb.KEY1); key1 != 0x80 {
+		t.Errorf("expected %X, got %X\n", 0x80, key1)
+	}
+
+	timer.cycles, spu.cycles, clock.cycles = 0, 0, 0
+	for i := 0; i < 4; i++ {
+		c.Step()
+	}
+	if timer.cycles != 4 || spu.cycles != 2 {
+		t.Errorf("expected the timer stepped by 4 and the APU by 2, got %d and %d\n", timer.cycles, spu.cycles)
+	}
+	if clock.cycles != 2 {
+		t.Errorf("expected the clock stepped by %d, got %d\n", 2, clock.cycles)
+	}
+
+	c.io.Store(go_gb.KEY1, c.io.Read(go_gb.KEY1)|0x01)
+	c.Step()
+	if c.stop || c.doubleSpeed {
+		t.Fatal("expected the cpu to switch back to normal speed")
+	}
+	if key1 := c.io.Read(go_gb.KEY1); key1 != 0 {
+		t.Errorf("expected %X, got %X\n", 0, key1)
+	}
+}
+
+func TestCpu_Interrupt_Dispatch(t *testing.T) {
+	tests := []struct {
+		pc, sp     uint16
+		ie, ifR    byte
+		expectedPc uint16
+		expectedIf byte
+	}{
+		{0x0123, 0xFFFE, 0x05, 0x05, 0x40, 0x04},
+		{0x0123, 0xFFFE, 0x0C, 0x0E, 0x50, 0x0A},
+		{0x0100, 0x0000, 0x01, 0x01, 0x40, 0x00}, // high byte pushed onto IE keeps V-Blank enabled
+		{0x0200, 0x0000, 0x01, 0x01, 0x00, 0x01}, // high byte pushed onto IE disables V-Blank which cancels the dispatch
+		{0x0400, 0x0000, 0x01, 0x05, 0x50, 0x01}, // IE is replaced by 0x04, the timer interrupt is dispatched instead
+	}
+	for i, test := range tests {
+		c := initCpu(nil)
+		c.pc, c.sp = test.pc, test.sp
+		c.ime = true
+		c.ier.Store(go_gb.IE, test.ie)
+		c.io.Store(go_gb.IF, test.ifR)
+
+		if mc := c.handleInterrupts(); mc != 5 {
+			t.Errorf("test %d expected 5 cycles, got %d\n", i, mc)
+		}
+		if c.pc != test.expectedPc {
+			t.Errorf("test %d expected PC %X, got %X\n", i, test.expectedPc, c.pc)
+		}
+		if ifR := c.io.Read(go_gb.IF); ifR != test.expectedIf {
+			t.Errorf("test %d expected IF %X, got %X\n", i, test.expectedIf, ifR)
+		}
+		if c.ime {
+			t.Errorf("test %d expected IME to be cleared\n", i)
+		}
+		if ret := go_gb.FromBytes(c.memory.ReadBytes(test.sp-2, 2)); test.sp != 0 && ret != test.pc {
+			t.Errorf("test %d expected return address %X, got %X\n", i, test.pc, ret)
+		}
+	}
+}
+
+func TestCpu_EI(t *testing.T) {
+	tests := []struct {
+		program    []byte
+		steps      int
+		expectedPc uint16
+	}{
+		{[]byte{0xFB, 0x00, 0x00}, 2, 0x0040},       // EI; NOP, the interrupt is dispatched after the NOP
+		{[]byte{0xFB, 0xF3, 0x00, 0x00}, 3, 0x0103}, // EI; DI, the interrupt is never dispatched
+		{[]byte{0xFB, 0x76, 0x00}, 2, 0x0040},       // EI; HALT, returns onto the HALT
+	}
+	for i, test := range tests {
+		fill := map[uint16]byte{}
+		for j, b := range test.program {
+			fill[0x0100+uint16(j)] = b
+		}
+		c := initCpu(fill)
+		c.pc = 0x0100
+		c.ier.Store(go_gb.IE, 0x01)
+		c.io.Store(go_gb.IF, 0x01)
+
+		for j := 0; j < test.steps; j++ {
+			c.Step()
+		}
+		if c.pc != test.expectedPc {
+			t.Errorf("test %d expected PC %X, got %X\n", i, test.expectedPc, c.pc)
+		}
+	}
+
+	c := initCpu(map[uint16]byte{0x0100: 0xFB, 0x0101: 0x76}) // EI; HALT
+	c.pc = 0x0100
+	c.ier.Store(go_gb.IE, 0x01)
+	c.io.Store(go_gb.IF, 0x01)
+	c.Step()
+	c.Step()
+	if ret := go_gb.FromBytes(c.memory.ReadBytes(c.sp, 2)); ret != 0x0101 {
+		t.Errorf("expected return address %X, got %X\n", 0x0101, ret)
+	}
+}
@@ -27,7 +27,7 @@ func jrnc(bit int) Instr {
 		} else {
 			c.readOpcode(&mc)
 		}
-		return 1 + mc
+		return mc
 	}
 }
 
@@ -39,7 +39,7 @@ func jrc(bit int) Instr {
 		} else {
 			c.readOpcode(&mc)
 		}
-		return 1 + mc
+		return mc
 	}
 }
 
@@ -52,19 +52,23 @@ func ret(c *cpu) go_gb.MC {
 
 func retnc(bit int) Instr {
 	return func(c *cpu) go_gb.MC {
+		var mc go_gb.MC
+		c.internal(&mc) // the condition is checked before popping
 		if !c.getFlag(bit) {
-			return ret(c) + 1
+			return ret(c) + mc
 		}
-		return 1
+		return mc
 	}
 }
 
 func retc(bit int) Instr {
 	return func(c *cpu) go_gb.MC {
+		var mc go_gb.MC
+		c.internal(&mc)
 		if c.getFlag(bit) {
-			return ret(c) + 1
+			return ret(c) + mc
 		}
-		return 1
+		return mc
 	}
 }
 
@@ -94,7 +98,7 @@ func jpnc(bit int, dst Ptr) Instr {
 		} else {
 			c.readFromPc(2, &mc)
 		}
-		return 2 + mc
+		return mc
 	}
 }
 
@@ -108,7 +112,7 @@ func jpc(bit int, dst Ptr) Instr {
 		} else {
 			c.readFromPc(2, &mc)
 		}
-		return 2 + mc
+		return mc
 	}
 }
 
@@ -120,12 +124,10 @@ func call(c *cpu) go_gb.MC {
 }
 
 func callAddr(c *cpu, addr []byte, mc *go_gb.MC) {
+	c.internal(mc) // SP is decremented before the pushes
 	pcBytes := go_gb.ToBytes(c.pc, true)
 	c.pushStack(pcBytes, mc)
 	c.pc = go_gb.FromBytes(addr)
-	if mc != nil {
-		*mc += 1
-	}
 }
 
 func callc(bit int) Instr {
@@ -136,7 +138,7 @@ func callc(bit int) Instr {
 		} else {
 			c.readFromPc(2, &mc)
 		}
-		return 2 + mc
+		return mc
 	}
 }
 
@@ -148,7 +150,7 @@ func callcc(bit int) Instr {
 		} else {
 			c.readFromPc(2, &mc)
 		}
-		return 2 + mc
+		return mc
 	}
 }
 
@@ -160,11 +162,12 @@ func reti(c *cpu) go_gb.MC {
 func rst(dst Ptr) Instr {
 	return func(c *cpu) go_gb.MC {
 		var cycles go_gb.MC
+		c.internal(&cycles)
 		pcBytes := go_gb.ToBytes(c.pc, true)
 		c.pushStack(pcBytes, &cycles)
 
 		bytes := dst.Load(c, &cycles)
-		c.setPc(go_gb.FromBytes(bytes), &cycles)
+		c.pc = go_gb.FromBytes(bytes)
 		return cycles
 	}
 }
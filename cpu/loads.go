@@ -89,7 +89,8 @@ func push(src Ptr) Instr {
 	return func(c *cpu) go_gb.MC {
 		var mc go_gb.MC
 		val := src.Load(c, &mc)
+		c.internal(&mc)
 		c.pushStack(val, &mc)
-		return mc + 1
+		return mc
 	}
 }
@@ -24,7 +24,7 @@ func rlc(dst Ptr) Instr {
 }
 
 func rlca(c *cpu) go_gb.MC {
-	return rlc(rx(go_gb.A))(c)
+	return rlc(rx(go_gb.A))(c) - 1 // the prefixed version counts the fetch of its opcode
 }
 
 func rl(dst Ptr) Instr {
@@ -49,7 +49,7 @@ func rl(dst Ptr) Instr {
 }
 
 func rla(c *cpu) go_gb.MC {
-	return rl(rx(go_gb.A))(c)
+	return rl(rx(go_gb.A))(c) - 1 // the prefixed version counts the fetch of its opcode
 }
 
 func rrc(dst Ptr) Instr {
@@ -74,7 +74,7 @@ func rrc(dst Ptr) Instr {
 }
 
 func rrca(c *cpu) go_gb.MC {
-	return rrc(rx(go_gb.A))(c)
+	return rrc(rx(go_gb.A))(c) - 1 // the prefixed version counts the fetch of its opcode
 }
 
 func rr(dst Ptr) Instr {
@@ -104,7 +104,7 @@ func rr(dst Ptr) Instr {
 }
 
 func rra(c *cpu) go_gb.MC {
-	return rr(rx(go_gb.A))(c)
+	return rr(rx(go_gb.A))(c) - 1 // the prefixed version counts the fetch of its opcode
 }
 
 func sla(dst Ptr) Instr {
@@ -5,16 +5,43 @@ import (
 	go_gb "go-gb"
 )
 
+// machine cycles the cpu is paused for while the speed is switched
+const speedSwitchDuration = 2050
+
 func NOP(c *cpu) go_gb.MC {
 	return 0
 }
 
-func STOP(c *cpu) go_gb.MC { // todo: halt until button pressed (joypad interrupt?)
+// stops the cpu until a button is pressed, on CGB it switches the speed instead when it was prepared in KEY1,
+// the switch pauses the cpu with the timer and DIV held
+func STOP(c *cpu) go_gb.MC {
+	c.memory.Store(go_gb.DIV, 0)
+	if key1 := c.io.Read(go_gb.KEY1); key1&1 != 0 {
+		c.doubleSpeed = !c.doubleSpeed
+		c.io.Store(go_gb.KEY1, (key1^0x80)&0x80)
+		var mc go_gb.MC
+		c.speedSwitch = true
+		for mc < speedSwitchDuration {
+			c.internal(&mc)
+		}
+		c.speedSwitch = false
+		return mc
+	}
 	c.stop = true
 	return 0
 }
 
+// halts the cpu until an interrupt is pending, with IME cleared and an interrupt already pending
+// the cpu doesn't halt but fails to increment PC after the next opcode fetch (HALT bug)
 func halt(c *cpu) go_gb.MC {
+	if c.eiWaiting != 0 && c.pendingInterrupts() != 0 { // EI; HALT returns from the interrupt onto the HALT
+		c.pc -= 1
+		return 0
+	}
+	if !c.ime && c.pendingInterrupts() != 0 {
+		c.haltBug = true
+		return 0
+	}
 	c.halt = true
 	return 0
 }
@@ -43,8 +70,10 @@ func invalid(c *cpu) go_gb.MC {
 	panic(InvalidOpErr)
 }
 
+// DI takes effect immediately and cancels a pending EI
 func di(c *cpu) go_gb.MC {
-	c.diWaiting = 2
+	c.ime = false
+	c.eiWaiting = 0
 	return 0
 }
 
@@ -43,6 +43,8 @@ type PPU interface {
 
 // sound processing unit
 type SPU interface {
+	Memory
+	Step(mc MC)
 }
 
 type CGBFlag byte
@@ -89,6 +91,14 @@ type Game struct {
 	RomSize       RomSize
 	RamSize       RamSize
 	NonJapanese   bool
+
+	Licensee         string // decoded from the old or the new licensee code
+	ManufacturerCode string // empty for cartridges without one
+	Version          byte   // mask ROM version
+	HeaderChecksum   Checksum
+	GlobalChecksum   Checksum
+	LogoValid        bool
+	SizeValid        bool // the file size matches RomSize
 }
 
 func (g *Game) String() string {
@@ -96,22 +106,49 @@ func (g *Game) String() string {
 	if !g.NonJapanese {
 		destination = "Japanese"
 	}
-	return fmt.Sprintf("Title: %s\n%s\n%s\nCartridge type: %s\nROM size: %s\nRAM size: %s\nDestination: %s",
+	manufacturer := g.ManufacturerCode
+	if manufacturer == "" {
+		manufacturer = "none"
+	}
+	logo := "valid"
+	if !g.LogoValid {
+		logo = "invalid"
+	}
+	romSize := g.RomSize.String()
+	if !g.SizeValid {
+		romSize += fmt.Sprintf(" (file has %d bytes)", len(g.Rom))
+	}
+	return fmt.Sprintf("Title: %s\n%s\n%s\nCartridge type: %s\nROM size: %s\nRAM size: %s\nDestination: %s\n"+
+		"Licensee: %s\nManufacturer: %s\nVersion: %d\nHeader checksum: %s\nGlobal checksum: %s\nLogo: %s",
 		g.Title, g.CGBFlag.String(), g.SGBFlag.String(),
-		g.CartridgeType.String(), g.RomSize.String(), g.RamSize.String(), destination)
+		g.CartridgeType.String(), romSize, g.RamSize.String(), destination,
+		g.Licensee, manufacturer, g.Version, g.HeaderChecksum.String(), g.GlobalChecksum.String(), logo)
 }
 
-func NewGame(rom []byte) *Game {
+func NewGame(rom []byte) (*Game, error) {
+	if err := ValidateRom(rom); err != nil {
+		return nil, err
+	}
+	manufacturer := manufacturerCode(rom)
+	romSize, _ := RomSize(rom[CartridgeROMSizeAddr]).GetSize()
 	return &Game{
 		Rom:           rom,
-		Title:         cleanTitle(string(rom[0x134:0x144])),
-		CGBFlag:       CGBFlag(rom[0x143]),
-		SGBFlag:       SGBFlag(rom[0x146]),
+		Title:         title(rom, manufacturer),
+		CGBFlag:       CGBFlag(rom[MemCGBFlag]),
+		SGBFlag:       SGBFlag(rom[MemSGBFlag]),
 		CartridgeType: CartridgeType(rom[CartridgeTypeAddr]),
 		RomSize:       RomSize(rom[CartridgeROMSizeAddr]),
 		RamSize:       RamSize(rom[CartridgeRAMSizeAddr]),
-		NonJapanese:   rom[0x14A] != 0,
-	}
+		NonJapanese:   rom[MemDestination] != 0,
+
+		Licensee:         licensee(rom),
+		ManufacturerCode: manufacturer,
+		Version:          rom[MemVersion],
+		HeaderChecksum:   HeaderChecksum(rom),
+		GlobalChecksum:   GlobalChecksum(rom),
+		LogoValid:        validLogo(rom),
+		SizeValid:        uint(len(rom)) == romSize,
+	}, nil
 }
 
 func cleanTitle(title string) string {
@@ -132,7 +169,7 @@ func LoadGame(rom io.ReadCloser) (*Game, error) {
 	if err != nil {
 		return nil, err
 	}
-	return NewGame(buf.Bytes()), nil
+	return NewGame(buf.Bytes())
 }
 
 type GameBoy struct {
@@ -148,7 +185,6 @@ func (g *GameBoy) Run() {
 		ppuFreq = 59.73     // Hz
 	)
 	for {
-		mc := g.cpu.Step()
-		g.ppu.Step(mc)
+		g.cpu.Step() // ticks the ppu and the spu itself
 	}
 }
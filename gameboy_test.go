@@ -0,0 +1,96 @@
+package go_gb
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestNewGame_Invalid(t *testing.T) {
+	if _, err := NewGame(make([]byte, 0x14F)); !errors.Is(err, ErrTruncatedROM) {
+		t.Errorf("expected %v, got %v\n", ErrTruncatedROM, err)
+	}
+
+	rom := make([]byte, 32*KiB)
+	rom[CartridgeRAMSizeAddr] = 0x09
+	if _, err := NewGame(rom); !errors.Is(err, ErrInvalidHeader) {
+		t.Errorf("expected %v, got %v\n", ErrInvalidHeader, err)
+	}
+}
+
+func TestGame_String_UnknownHeader(t *testing.T) {
+	game := &Game{CartridgeType: 0x42, RomSize: 0x42, RamSize: 0x42}
+	if !strings.Contains(game.String(), "unknown (42)") {
+		t.Errorf("expected the unknown values in %q\n", game.String())
+	}
+	if size, banks := RomSize(0x42).GetSize(); size != 0 || banks != 0 {
+		t.Errorf("expected no size, got %d in %d banks\n", size, banks)
+	}
+}
+
+func createHeader() []byte {
+	rom := make([]byte, 32*KiB)
+	copy(rom[MemNintendoLogoStart:], NintendoLogo[:])
+	copy(rom[MemTitleStart:], "GAMETITLE")
+	copy(rom[MemManufacturerStart:], "AB1E")
+	rom[MemCGBFlag] = byte(CGBSupport)
+	copy(rom[MemNewLicensee:], "01")
+	rom[MemOldLicensee] = 0x33
+	rom[MemVersion] = 2
+	rom[MemHeaderChecksum] = byte(HeaderChecksum(rom).Computed)
+	sum := GlobalChecksum(rom).Computed
+	rom[MemGlobalChecksum] = byte(sum >> 8)
+	rom[MemGlobalChecksum+1] = byte(sum)
+	return rom
+}
+
+func TestNewGame_Header(t *testing.T) {
+	game, err := NewGame(createHeader())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if game.Title != "GAMETITLE" {
+		t.Errorf("expected title %q, got %q\n", "GAMETITLE", game.Title)
+	}
+	if game.ManufacturerCode != "AB1E" {
+		t.Errorf("expected manufacturer %q, got %q\n", "AB1E", game.ManufacturerCode)
+	}
+	if game.Licensee != "Nintendo R&D1" {
+		t.Errorf("expected licensee %q, got %q\n", "Nintendo R&D1", game.Licensee)
+	}
+	if game.Version != 2 {
+		t.Errorf("expected version %d, got %d\n", 2, game.Version)
+	}
+	if !game.HeaderChecksum.Valid() || !game.GlobalChecksum.Valid() || !game.LogoValid || !game.SizeValid {
+		t.Errorf("expected a valid header, got\n%s\n", game.String())
+	}
+}
+
+func TestNewGame_InvalidHeader(t *testing.T) {
+	rom := createHeader()
+	rom[MemNintendoLogoStart] = 0
+	rom[MemVersion] = 3
+	rom[MemOldLicensee] = 0x01
+	game, err := NewGame(rom[:16*KiB])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if game.Licensee != "Nintendo" {
+		t.Errorf("expected licensee %q, got %q\n", "Nintendo", game.Licensee)
+	}
+	if game.HeaderChecksum.Valid() {
+		t.Error("expected an invalid header checksum")
+	}
+	if game.GlobalChecksum.Valid() {
+		t.Error("expected an invalid global checksum")
+	}
+	if game.LogoValid {
+		t.Error("expected an invalid logo")
+	}
+	if game.SizeValid {
+		t.Error("expected the file size to mismatch the header")
+	}
+	if !strings.Contains(game.String(), "file has 16384 bytes") {
+		t.Errorf("expected the file size in %q\n", game.String())
+	}
+}
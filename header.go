@@ -0,0 +1,323 @@
+package go_gb
+
+import "fmt"
+
+const (
+	MemManufacturerStart uint16 = 0x013F // 4 bytes, only in newer cartridges
+	MemNewLicensee       uint16 = 0x0144 // 2 ASCII characters
+	MemSGBFlag           uint16 = 0x0146
+	MemDestination       uint16 = 0x014A
+	MemOldLicensee       uint16 = 0x014B
+	MemVersion           uint16 = 0x014C
+)
+
+// old licensee code telling that the new licensee code is used instead
+const useNewLicensee byte = 0x33
+
+// logo compared by the boot ROM, the Game Boy locks up if it doesn't match
+var NintendoLogo = [MemNintendoLogoEnd - MemNintendoLogoStart + 1]byte{
+	0xCE, 0xED, 0x66, 0x66, 0xCC, 0x0D, 0x00, 0x0B, 0x03, 0x73, 0x00, 0x83, 0x00, 0x0C, 0x00, 0x0D,
+	0x00, 0x08, 0x11, 0x1F, 0x88, 0x89, 0x00, 0x0E, 0xDC, 0xCC, 0x6E, 0xE6, 0xDD, 0xDD, 0xD9, 0x99,
+	0xBB, 0xBB, 0x67, 0x63, 0x6E, 0x0E, 0xEC, 0xCC, 0xDD, 0xDC, 0x99, 0x9F, 0xBB, 0xB9, 0x33, 0x3E,
+}
+
+type Checksum struct {
+	Stored   uint16
+	Computed uint16
+}
+
+func (c Checksum) Valid() bool {
+	return c.Stored == c.Computed
+}
+
+func (c Checksum) String() string {
+	if c.Valid() {
+		return fmt.Sprintf("%X (valid)", c.Stored)
+	}
+	return fmt.Sprintf("%X (invalid, computed %X)", c.Stored, c.Computed)
+}
+
+// checksum of 0x134-0x14C checked by the boot ROM
+func HeaderChecksum(rom []byte) Checksum {
+	var x byte
+	for _, val := range rom[MemTitleStart:MemHeaderChecksum] {
+		x = x - val - 1
+	}
+	return Checksum{Stored: uint16(rom[MemHeaderChecksum]), Computed: uint16(x)}
+}
+
+// sum of all bytes except the checksum itself, not checked by the hardware
+func GlobalChecksum(rom []byte) Checksum {
+	var sum uint16
+	for i, val := range rom {
+		if i != int(MemGlobalChecksum) && i != int(MemGlobalChecksum)+1 {
+			sum += uint16(val)
+		}
+	}
+	stored := uint16(rom[MemGlobalChecksum])<<8 | uint16(rom[MemGlobalChecksum+1])
+	return Checksum{Stored: stored, Computed: sum}
+}
+
+func validLogo(rom []byte) bool {
+	for i, val := range NintendoLogo {
+		if rom[int(MemNintendoLogoStart)+i] != val {
+			return false
+		}
+	}
+	return true
+}
+
+// newer CGB cartridges shorten the title to store a 4 character manufacturer code
+func manufacturerCode(rom []byte) string {
+	flag := CGBFlag(rom[MemCGBFlag])
+	if flag != CGBSupport && flag != OnlyCGB {
+		return ""
+	}
+	code := rom[MemManufacturerStart:MemCGBFlag]
+	for _, char := range code {
+		if (char < 'A' || char > 'Z') && (char < '0' || char > '9') {
+			return ""
+		}
+	}
+	return string(code)
+}
+
+func title(rom []byte, manufacturer string) string {
+	end := MemTitleEnd + 1
+	if flag := CGBFlag(rom[MemCGBFlag]); flag == CGBSupport || flag == OnlyCGB {
+		end = MemCGBFlag
+	}
+	if manufacturer != "" {
+		end = MemManufacturerStart
+	}
+	return cleanTitle(string(rom[MemTitleStart:end]))
+}
+
+// decodes the publisher from the old licensee code, or the new one if the old code tells so
+func licensee(rom []byte) string {
+	old := rom[MemOldLicensee]
+	if old == useNewLicensee {
+		code := string(rom[MemNewLicensee : MemNewLicensee+2])
+		if name, ok := newLicensees[code]; ok {
+			return name
+		}
+		return fmt.Sprintf("unknown (%q)", code)
+	}
+	if name, ok := oldLicensees[old]; ok {
+		return name
+	}
+	return fmt.Sprintf("unknown (%02X)", old)
+}
+
+var newLicensees = map[string]string{
+	"00": "None",
+	"01": "Nintendo R&D1",
+	"08": "Capcom",
+	"13": "Electronic Arts",
+	"18": "Hudson Soft",
+	"19": "b-ai",
+	"20": "KSS",
+	"22": "POW",
+	"24": "PCM Complete",
+	"25": "San-X",
+	"28": "Kemco Japan",
+	"29": "Seta",
+	"30": "Viacom",
+	"31": "Nintendo",
+	"32": "Bandai",
+	"33": "Ocean/Acclaim",
+	"34": "Konami",
+	"35": "Hector",
+	"37": "Taito",
+	"38": "Hudson",
+	"39": "Banpresto",
+	"41": "Ubi Soft",
+	"42": "Atlus",
+	"44": "Malibu",
+	"46": "Angel",
+	"47": "Bullet-Proof",
+	"49": "Irem",
+	"50": "Absolute",
+	"51": "Acclaim",
+	"52": "Activision",
+	"53": "American Sammy",
+	"54": "Konami",
+	"55": "Hi Tech Entertainment",
+	"56": "LJN",
+	"57": "Matchbox",
+	"58": "Mattel",
+	"59": "Milton Bradley",
+	"60": "Titus",
+	"61": "Virgin",
+	"64": "LucasArts",
+	"67": "Ocean",
+	"69": "Electronic Arts",
+	"70": "Infogrames",
+	"71": "Interplay",
+	"72": "Broderbund",
+	"73": "Sculptured",
+	"75": "SCi",
+	"78": "THQ",
+	"79": "Accolade",
+	"80": "Misawa",
+	"83": "Lozc",
+	"86": "Tokuma Shoten Intermedia",
+	"87": "Tsukuda Original",
+	"91": "Chunsoft",
+	"92": "Video System",
+	"93": "Ocean/Acclaim",
+	"95": "Varie",
+	"96": "Yonezawa/S'pal",
+	"97": "Kaneko",
+	"99": "Pack-In-Soft",
+	"A4": "Konami (Yu-Gi-Oh!)",
+}
+
+var oldLicensees = map[byte]string{
+	0x00: "None",
+	0x01: "Nintendo",
+	0x08: "Capcom",
+	0x09: "Hot-B",
+	0x0A: "Jaleco",
+	0x0B: "Coconuts Japan",
+	0x0C: "Elite Systems",
+	0x13: "Electronic Arts",
+	0x18: "Hudson Soft",
+	0x19: "ITC Entertainment",
+	0x1A: "Yanoman",
+	0x1D: "Japan Clary",
+	0x1F: "Virgin Interactive",
+	0x24: "PCM Complete",
+	0x25: "San-X",
+	0x28: "Kotobuki Systems",
+	0x29: "Seta",
+	0x30: "Infogrames",
+	0x31: "Nintendo",
+	0x32: "Bandai",
+	0x34: "Konami",
+	0x35: "HectorSoft",
+	0x38: "Capcom",
+	0x39: "Banpresto",
+	0x3C: "Entertainment International",
+	0x3E: "Gremlin",
+	0x41: "Ubi Soft",
+	0x42: "Atlus",
+	0x44: "Malibu",
+	0x46: "Angel",
+	0x47: "Spectrum HoloByte",
+	0x49: "Irem",
+	0x4A: "Virgin Interactive",
+	0x4D: "Malibu",
+	0x4F: "U.S. Gold",
+	0x50: "Absolute",
+	0x51: "Acclaim",
+	0x52: "Activision",
+	0x53: "American Sammy",
+	0x54: "GameTek",
+	0x55: "Park Place",
+	0x56: "LJN",
+	0x57: "Matchbox",
+	0x59: "Milton Bradley",
+	0x5A: "Mindscape",
+	0x5B: "Romstar",
+	0x5C: "Naxat Soft",
+	0x5D: "Tradewest",
+	0x60: "Titus",
+	0x61: "Virgin Interactive",
+	0x67: "Ocean",
+	0x69: "Electronic Arts",
+	0x6E: "Elite Systems",
+	0x6F: "Electro Brain",
+	0x70: "Infogrames",
+	0x71: "Interplay",
+	0x72: "Broderbund",
+	0x73: "Sculptured Software",
+	0x75: "The Sales Curve",
+	0x78: "THQ",
+	0x79: "Accolade",
+	0x7A: "Triffix Entertainment",
+	0x7C: "MicroProse",
+	0x7F: "Kemco",
+	0x80: "Misawa Entertainment",
+	0x83: "Lozc",
+	0x86: "Tokuma Shoten Intermedia",
+	0x8B: "Bullet-Proof Software",
+	0x8C: "Vic Tokai",
+	0x8E: "Ape",
+	0x8F: "I'Max",
+	0x91: "Chunsoft",
+	0x92: "Video System",
+	0x93: "Tsuburaya Productions",
+	0x95: "Varie",
+	0x96: "Yonezawa/S'pal",
+	0x97: "Kaneko",
+	0x99: "Arc",
+	0x9A: "Nihon Bussan",
+	0x9B: "Tecmo",
+	0x9C: "Imagineer",
+	0x9D: "Banpresto",
+	0x9F: "Nova",
+	0xA1: "Hori Electric",
+	0xA2: "Bandai",
+	0xA4: "Konami",
+	0xA6: "Kawada",
+	0xA7: "Takara",
+	0xA9: "Technos Japan",
+	0xAA: "Broderbund",
+	0xAC: "Toei Animation",
+	0xAD: "Toho",
+	0xAF: "Namco",
+	0xB0: "Acclaim",
+	0xB1: "ASCII or Nexsoft",
+	0xB2: "Bandai",
+	0xB4: "Square Enix",
+	0xB6: "HAL Laboratory",
+	0xB7: "SNK",
+	0xB9: "Pony Canyon",
+	0xBA: "Culture Brain",
+	0xBB: "Sunsoft",
+	0xBD: "Sony Imagesoft",
+	0xBF: "Sammy",
+	0xC0: "Taito",
+	0xC2: "Kemco",
+	0xC3: "Squaresoft",
+	0xC4: "Tokuma Shoten Intermedia",
+	0xC5: "Data East",
+	0xC6: "Tonkinhouse",
+	0xC8: "Koei",
+	0xC9: "UFL",
+	0xCA: "Ultra",
+	0xCB: "Vap",
+	0xCC: "Use Corporation",
+	0xCD: "Meldac",
+	0xCE: "Pony Canyon",
+	0xCF: "Angel",
+	0xD0: "Taito",
+	0xD1: "Sofel",
+	0xD2: "Quest",
+	0xD3: "Sigma Enterprises",
+	0xD4: "ASK Kodansha",
+	0xD6: "Naxat Soft",
+	0xD7: "Copya System",
+	0xD9: "Banpresto",
+	0xDA: "Tomy",
+	0xDB: "LJN",
+	0xDD: "NCS",
+	0xDE: "Human",
+	0xDF: "Altron",
+	0xE0: "Jaleco",
+	0xE1: "Towa Chiki",
+	0xE2: "Yutaka",
+	0xE3: "Varie",
+	0xE5: "Epoch",
+	0xE7: "Athena",
+	0xE8: "Asmik Ace Entertainment",
+	0xE9: "Natsume",
+	0xEA: "King Records",
+	0xEB: "Atlus",
+	0xEC: "Epic/Sony Records",
+	0xEE: "IGS",
+	0xF0: "A Wave",
+	0xF3: "Extreme Entertainment",
+	0xFF: "LJN",
+}
@@ -19,6 +19,44 @@ const (
 	JOYP uint16 = 0xFF00
 )
 
+// bitmask of joypad buttons, the order matches the JOYP bits of the direction and button groups
+type Button byte
+
+const (
+	ButtonRight Button = 1 << iota
+	ButtonLeft
+	ButtonUp
+	ButtonDown
+	ButtonA
+	ButtonB
+	ButtonSelect
+	ButtonStart
+)
+
+// joypad stepped with the cpu so it can request the joypad interrupt
+type Joypad interface {
+	Reader
+	Step(mc MC)
+}
+
+// joypad that reads the selected button group from the IO registers
+type IOJoypad interface {
+	Joypad
+	Init(io Memory)
+}
+
+// returns the JOYP value for the group selection (bits 4 and 5 of the last JOYP write) and the pressed buttons
+func JoypadState(selection byte, pressed Button) byte {
+	result := 0xC0 | (selection & 0x30) | 0x0F
+	if selection&0x10 == 0 { // P14 selects the direction keys
+		result &^= byte(pressed) & 0x0F
+	}
+	if selection&0x20 == 0 { // P15 selects the button keys
+		result &^= byte(pressed>>4) & 0x0F
+	}
+	return result
+}
+
 var NOPJoypad = &nopJoypad{}
 
 type nopJoypad struct {
@@ -27,3 +65,6 @@ type nopJoypad struct {
 func (n *nopJoypad) Read(pointer uint16) byte {
 	return 0xF
 }
+
+func (n *nopJoypad) Step(mc MC) {
+}
@@ -0,0 +1,88 @@
+package joypad
+
+import (
+	go_gb "go-gb"
+	"sync"
+)
+
+// joypad with the P14/P15 button matrix, the buttons can be changed from any goroutine
+type joypad struct {
+	io go_gb.Memory
+
+	pressed   go_gb.Button
+	selection byte // group selection of the last JOYP read
+	lines     byte // P10-P13 at the last step
+	interrupt bool // a line went low since the last step
+
+	mutex sync.Mutex
+}
+
+func NewJoypad() *joypad {
+	return &joypad{selection: 0x30, lines: 0x0F}
+}
+
+func (j *joypad) Init(io go_gb.Memory) {
+	j.io = io
+}
+
+func (j *joypad) Press(buttons go_gb.Button) {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	j.setState(j.pressed | buttons)
+}
+
+func (j *joypad) Release(buttons go_gb.Button) {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	j.setState(j.pressed &^ buttons)
+}
+
+// replaces all pressed buttons
+func (j *joypad) SetState(buttons go_gb.Button) {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	j.setState(buttons)
+}
+
+func (j *joypad) setState(buttons go_gb.Button) {
+	before := go_gb.JoypadState(j.selection, j.pressed) & 0x0F
+	after := go_gb.JoypadState(j.selection, buttons) & 0x0F
+	if before&^after != 0 { // remember short presses that could be released before the next step
+		j.interrupt = true
+	}
+	j.pressed = buttons
+}
+
+func (j *joypad) Buttons() go_gb.Button {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	return j.pressed
+}
+
+func (j *joypad) Read(pointer uint16) byte {
+	if pointer != go_gb.JOYP {
+		panic("invalid read from JOYP")
+	}
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	j.selection = j.io.Read(go_gb.JOYP)
+	return go_gb.JoypadState(j.selection, j.pressed)
+}
+
+// requests the joypad interrupt when one of the selected lines went from high to low
+func (j *joypad) Step(mc go_gb.MC) {
+	lines := j.Read(go_gb.JOYP) & 0x0F
+
+	j.mutex.Lock()
+	interrupt := j.interrupt || j.lines&^lines != 0
+	j.interrupt = false
+	j.lines = lines
+	j.mutex.Unlock()
+
+	if interrupt {
+		go_gb.Update(j.io, go_gb.IF, func(b byte) byte {
+			go_gb.Set(&b, int(go_gb.BitJoypad), true)
+			return b
+		})
+	}
+}
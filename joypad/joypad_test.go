@@ -0,0 +1,107 @@
+package joypad
+
+import (
+	go_gb "go-gb"
+	"testing"
+)
+
+type mockIO struct {
+	joyp, interruptFlag byte
+}
+
+func (m *mockIO) ReadBytes(pointer, n uint16) []byte {
+	panic("implement me")
+}
+
+func (m *mockIO) Read(pointer uint16) byte {
+	switch pointer {
+	case go_gb.JOYP:
+		return m.joyp
+	case go_gb.IF:
+		return m.interruptFlag
+	}
+	panic("implement me")
+}
+
+func (m *mockIO) StoreBytes(pointer uint16, bytes []byte) {
+	panic("implement me")
+}
+
+func (m *mockIO) Store(pointer uint16, val byte) {
+	switch pointer {
+	case go_gb.JOYP:
+		m.joyp = val
+	case go_gb.IF:
+		m.interruptFlag = val
+	default:
+		panic("implement me")
+	}
+}
+
+func newTestJoypad(selection byte) (*joypad, *mockIO) {
+	io := &mockIO{joyp: selection}
+	j := NewJoypad()
+	j.Init(io)
+	j.Step(1)
+	return j, io
+}
+
+func TestJoypad_Read(t *testing.T) {
+	j, io := newTestJoypad(0x30)
+	j.Press(go_gb.ButtonUp | go_gb.ButtonStart)
+	if val := j.Read(go_gb.JOYP); val != 0xFF {
+		t.Errorf("expected no group to be selected %X, got %X\n", 0xFF, val)
+	}
+	io.joyp = 0x20
+	if val := j.Read(go_gb.JOYP); val != 0xEB {
+		t.Errorf("expected the direction keys %X, got %X\n", 0xEB, val)
+	}
+	io.joyp = 0x10
+	if val := j.Read(go_gb.JOYP); val != 0xD7 {
+		t.Errorf("expected the button keys %X, got %X\n", 0xD7, val)
+	}
+	j.Release(go_gb.ButtonStart)
+	if val := j.Read(go_gb.JOYP); val != 0xDF {
+		t.Errorf("expected %X, got %X\n", 0xDF, val)
+	}
+	j.SetState(go_gb.ButtonA)
+	if j.Buttons() != go_gb.ButtonA {
+		t.Errorf("expected %08b, got %08b\n", go_gb.ButtonA, j.Buttons())
+	}
+}
+
+func TestJoypad_Interrupt(t *testing.T) {
+	j, io := newTestJoypad(0x20) // directions selected
+	j.Press(go_gb.ButtonA)
+	j.Step(1)
+	if go_gb.Bit(io.interruptFlag, int(go_gb.BitJoypad)) {
+		t.Error("expected no interrupt for a button of the unselected group")
+	}
+
+	j.Press(go_gb.ButtonDown)
+	j.Step(1)
+	if !go_gb.Bit(io.interruptFlag, int(go_gb.BitJoypad)) {
+		t.Error("expected an interrupt when a selected line goes low")
+	}
+
+	io.interruptFlag = 0
+	j.Release(go_gb.ButtonDown)
+	j.Step(1)
+	if io.interruptFlag != 0 {
+		t.Error("expected no interrupt when a line goes high")
+	}
+
+	io.joyp = 0x10 // selecting the buttons while A is held pulls P10 low
+	j.Step(1)
+	if !go_gb.Bit(io.interruptFlag, int(go_gb.BitJoypad)) {
+		t.Error("expected an interrupt when the selection change pulls a line low")
+	}
+
+	io.interruptFlag = 0
+	j.Press(go_gb.ButtonB)
+	j.Release(go_gb.ButtonB)
+	j.Step(1)
+	if !go_gb.Bit(io.interruptFlag, int(go_gb.BitJoypad)) {
+		t.Error("expected an interrupt for a press released before the step")
+	}
+}
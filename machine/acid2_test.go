@@ -0,0 +1,61 @@
+package machine
+
+import (
+	"image/color"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// frames after which dmg-acid2 has drawn its final image, including the boot ROM
+const acid2Frames = 120
+
+// reads a reference screenshot as color ids, white is 0 and black is 3
+func readReference(t *testing.T, path string) []byte {
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	img, err := png.Decode(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bounds := img.Bounds()
+	if bounds.Dx() != 160 || bounds.Dy() != 144 {
+		t.Fatalf("expected a 160x144 image, got %dx%d\n", bounds.Dx(), bounds.Dy())
+	}
+
+	frame := make([]byte, 160*144)
+	for y := 0; y < 144; y++ {
+		for x := 0; x < 160; x++ {
+			gray := color.GrayModel.Convert(img.At(bounds.Min.X+x, bounds.Min.Y+y)).(color.Gray)
+			frame[y*160+x] = 3 - byte((int(gray.Y)+0x2A)/0x55) // nearest of FF, AA, 55 and 00
+		}
+	}
+	return frame
+}
+
+func TestMachine_DmgAcid2(t *testing.T) {
+	dir := filepath.Join("testdata", "dmg-acid2")
+	rom, err := ioutil.ReadFile(filepath.Join(dir, "dmg-acid2.gb"))
+	if os.IsNotExist(err) {
+		t.Skip("copy dmg-acid2.gb and reference-dmg.png to testdata/dmg-acid2 to run dmg-acid2")
+	} else if err != nil {
+		t.Fatal(err)
+	}
+	expected := readReference(t, filepath.Join(dir, "reference-dmg.png"))
+
+	m := newMachine(t, rom, WithPixelFIFO())
+	for i := 0; i < acid2Frames; i++ {
+		m.RunFrame()
+	}
+	frame := m.Frame()
+	for i := range expected {
+		if frame[i] != expected[i] {
+			t.Fatalf("pixel %d, %d: expected %X, got %X\n", i%160, i/160, expected[i], frame[i])
+		}
+	}
+}
@@ -0,0 +1,334 @@
+package machine
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	go_gb "go-gb"
+	"go-gb/cpu"
+	"go-gb/memory"
+	"io"
+	"io/ioutil"
+)
+
+// Best Effort Save State (BESS) footer format used by SameBoy, BGB and other emulators
+const (
+	bessMagic      = "BESS"
+	bessFooterSize = 8
+	bessMajor      = 1
+	bessMinor      = 1
+	bessName       = "go-gb"
+
+	bessHalted  = 1
+	bessStopped = 2
+
+	oamSize  = memory.OAMEnd - memory.OAMStart + 1
+	hramSize = memory.HRAMEnd - memory.HRAMStart + 1
+	vramSize = memory.VRAMEnd - memory.VRAMStart + 1
+	ioSize   = memory.IOPortsEnd - memory.IOPortsStart + 1
+)
+
+type bessBuffer struct {
+	Size, Offset uint32
+}
+
+type bessCore struct {
+	Major, Minor           uint16
+	Model                  [4]byte
+	PC, AF, BC, DE, HL, SP uint16
+	IME, IE                byte
+	ExecutionState         byte
+	Reserved               byte
+	IO                     [ioSize]byte
+
+	RAM, VRAM, MBCRAM, OAM, HRAM       bessBuffer
+	BackgroundPalettes, ObjectPalettes bessBuffer
+}
+
+type bessInfo struct {
+	Title          [go_gb.MemTitleEnd - go_gb.MemTitleStart + 1]byte
+	GlobalChecksum [2]byte
+}
+
+type bessWriter struct {
+	bytes.Buffer
+}
+
+// appends the data to the file and returns where it was stored
+func (b *bessWriter) buffer(data []byte) bessBuffer {
+	result := bessBuffer{Size: uint32(len(data)), Offset: uint32(b.Len())}
+	b.Write(data)
+	return result
+}
+
+func (b *bessWriter) block(name string, data interface{}) {
+	size := binary.Size(data)
+	if raw, ok := data.([]byte); ok {
+		size = len(raw)
+	}
+	b.WriteString(name)
+	_ = binary.Write(b, binary.LittleEndian, uint32(size))
+	_ = binary.Write(b, binary.LittleEndian, data)
+}
+
+// returns the cartridge RAM without the RTC footer
+func (m *machine) cartridgeRAM() []byte {
+	cartridge := m.mmu.Cartridge()
+	ram := cartridge.ExportRAM()
+	if rtc, ok := cartridge.(memory.RTCCartridge); ok {
+		ram = ram[:len(ram)-len(rtc.ExportRTC())]
+	}
+	return ram
+}
+
+func (m *machine) readIO() [ioSize]byte {
+	var result [ioSize]byte
+	for i := range result {
+		pointer := memory.IOPortsStart + uint16(i)
+		if go_gb.SoundStart <= pointer && pointer <= go_gb.SoundEnd {
+			result[i] = m.spu.Read(pointer)
+		} else {
+			result[i] = m.mmu.IO().Read(pointer)
+		}
+	}
+	result[go_gb.BOOT-memory.IOPortsStart] = go_gb.BitToByte(m.mmu.Booted())
+	return result
+}
+
+// writes the machine state in the BESS format, other emulators can load it
+func (m *machine) SaveBESS(w io.Writer) error {
+	var b bessWriter
+
+	registers := m.cpu.Registers()
+	core := bessCore{
+		Major: bessMajor, Minor: bessMinor,
+		PC: registers.PC, AF: registers.AF, BC: registers.BC, DE: registers.DE, HL: registers.HL, SP: registers.SP,
+		IME: go_gb.BitToByte(registers.IME),
+		IE:  m.mmu.InterruptEnableRegister().Read(memory.InterruptEnableRegister),
+		IO:  m.readIO(),
+	}
+	copy(core.Model[:], "GD  ")
+	if registers.Halt {
+		core.ExecutionState = bessHalted
+	} else if registers.Stop {
+		core.ExecutionState = bessStopped
+	}
+	core.RAM = b.buffer(m.mmu.WRAM())
+	core.VRAM = b.buffer(m.mmu.VRAM().ReadBytes(memory.VRAMStart, vramSize))
+	core.MBCRAM = b.buffer(m.cartridgeRAM())
+	core.OAM = b.buffer(m.mmu.OAM().ReadBytes(memory.OAMStart, oamSize))
+	core.HRAM = b.buffer(m.mmu.HRAM().ReadBytes(memory.HRAMStart, hramSize))
+
+	var info bessInfo
+	copy(info.Title[:], m.rom[go_gb.MemTitleStart:go_gb.MemTitleEnd+1])
+	copy(info.GlobalChecksum[:], m.rom[go_gb.MemGlobalChecksum:go_gb.MemGlobalChecksum+2])
+
+	first := uint32(b.Len())
+	b.block("NAME", []byte(bessName))
+	b.block("INFO", &info)
+	b.block("CORE", &core)
+	if cartridge, ok := m.mmu.Cartridge().(memory.RegisterCartridge); ok {
+		var writes []byte
+		for _, write := range cartridge.RegisterWrites() {
+			writes = append(writes, byte(write.Address), byte(write.Address>>8), write.Value)
+		}
+		if len(writes) > 0 {
+			b.block("MBC ", writes)
+		}
+	}
+	if cartridge, ok := m.mmu.Cartridge().(memory.RTCCartridge); ok {
+		if rtc := cartridge.ExportRTC(); rtc != nil {
+			b.block("RTC ", rtc)
+		}
+	}
+	b.block("END ", []byte{})
+
+	_ = binary.Write(&b, binary.LittleEndian, first)
+	b.WriteString(bessMagic)
+	_, err := b.WriteTo(w)
+	return err
+}
+
+// blocks of a BESS file that we know how to load
+type bessState struct {
+	data []byte
+
+	core      *bessCore
+	info      *bessInfo
+	mbcWrites []memory.RegisterWrite
+	rtc       []byte
+}
+
+func (s *bessState) buffer(buffer bessBuffer) ([]byte, error) {
+	end := uint64(buffer.Offset) + uint64(buffer.Size)
+	if end > uint64(len(s.data)) {
+		return nil, fmt.Errorf("%w: buffer at %X out of bounds", ErrInvalidState, buffer.Offset)
+	}
+	return s.data[buffer.Offset:end], nil
+}
+
+func parseBESS(data []byte) (*bessState, error) {
+	if len(data) < bessFooterSize || string(data[len(data)-4:]) != bessMagic {
+		return nil, ErrInvalidState
+	}
+	state := &bessState{data: data}
+	footer := len(data) - bessFooterSize
+	offset := int(binary.LittleEndian.Uint32(data[footer:]))
+	for {
+		if offset < 0 || offset+8 > footer {
+			return nil, fmt.Errorf("%w: missing END block", ErrInvalidState)
+		}
+		name := string(data[offset : offset+4])
+		size := int(binary.LittleEndian.Uint32(data[offset+4:]))
+		offset += 8
+		if size < 0 || offset+size > footer {
+			return nil, fmt.Errorf("%w: block %q out of bounds", ErrInvalidState, name)
+		}
+		block := data[offset : offset+size]
+		offset += size
+
+		switch name {
+		case "CORE":
+			state.core = &bessCore{}
+			if size < binary.Size(state.core) {
+				return nil, fmt.Errorf("%w: CORE block too small", ErrInvalidState)
+			}
+			_ = binary.Read(bytes.NewReader(block), binary.LittleEndian, state.core)
+		case "INFO":
+			state.info = &bessInfo{}
+			if size < binary.Size(state.info) {
+				return nil, fmt.Errorf("%w: INFO block too small", ErrInvalidState)
+			}
+			_ = binary.Read(bytes.NewReader(block), binary.LittleEndian, state.info)
+		case "MBC ":
+			if size%3 != 0 {
+				return nil, fmt.Errorf("%w: invalid MBC block size %d", ErrInvalidState, size)
+			}
+			for i := 0; i < size; i += 3 {
+				state.mbcWrites = append(state.mbcWrites, memory.RegisterWrite{
+					Address: binary.LittleEndian.Uint16(block[i:]),
+					Value:   block[i+2],
+				})
+			}
+		case "RTC ":
+			state.rtc = block
+		case "END ":
+			if state.core == nil {
+				return nil, fmt.Errorf("%w: missing CORE block", ErrInvalidState)
+			}
+			return state, nil
+		}
+		// other blocks are optional, we skip the ones we don't support
+	}
+}
+
+// loads a BESS save state written by this or another emulator
+func (m *machine) LoadBESS(r io.Reader) error {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	state, err := parseBESS(data)
+	if err != nil {
+		return err
+	}
+	core := state.core
+	if core.Major != bessMajor {
+		return fmt.Errorf("unsupported BESS version %d.%d", core.Major, core.Minor)
+	}
+	if core.Model[0] != 'G' && core.Model[0] != 'S' {
+		return fmt.Errorf("unsupported BESS model %q", string(core.Model[:]))
+	}
+	if state.info != nil && !bytes.Equal(state.info.GlobalChecksum[:], m.rom[go_gb.MemGlobalChecksum:go_gb.MemGlobalChecksum+2]) {
+		return ErrStateMismatch
+	}
+	var buffers [5][]byte
+	for i, buffer := range [...]bessBuffer{core.RAM, core.VRAM, core.MBCRAM, core.OAM, core.HRAM} {
+		if buffers[i], err = state.buffer(buffer); err != nil {
+			return err
+		}
+	}
+	wram, vram, mbcRam, oam, hram := buffers[0], buffers[1], buffers[2], buffers[3], buffers[4]
+
+	// the cartridge can still reject its blocks, it's rolled back so a failed load leaves the machine untouched
+	var backup bytes.Buffer
+	if err := m.SaveState(&backup); err != nil {
+		return err
+	}
+	if err := m.loadBESSCartridge(state, mbcRam); err != nil {
+		m.restore(&backup)
+		return fmt.Errorf("%w: %v", ErrInvalidState, err)
+	}
+
+	m.cpu.SetRegisters(cpu.Registers{
+		PC: core.PC, SP: core.SP, AF: core.AF, BC: core.BC, DE: core.DE, HL: core.HL,
+		IME:  core.IME != 0,
+		Halt: core.ExecutionState == bessHalted,
+		Stop: core.ExecutionState == bessStopped,
+	})
+	copy(m.mmu.WRAM(), wram)
+	m.mmu.VRAM().StoreBytes(memory.VRAMStart, truncate(vram, vramSize))
+	m.mmu.OAM().StoreBytes(memory.OAMStart, truncate(oam, oamSize))
+	m.mmu.HRAM().StoreBytes(memory.HRAMStart, truncate(hram, hramSize))
+	m.mmu.InterruptEnableRegister().Store(memory.InterruptEnableRegister, core.IE)
+	m.loadIO(core.IO)
+	m.ppu.LoadRegisters()
+	m.timer.LoadRegisters()
+	return nil
+}
+
+func (m *machine) loadBESSCartridge(state *bessState, ram []byte) error {
+	cartridge := m.mmu.Cartridge()
+	if len(ram) > 0 {
+		if err := cartridge.ImportRAM(ram); err != nil {
+			return err
+		}
+	}
+	if rtc, ok := cartridge.(memory.RTCCartridge); ok && state.rtc != nil {
+		if err := rtc.ImportRTC(state.rtc); err != nil {
+			return err
+		}
+	}
+	for _, write := range state.mbcWrites {
+		if write.Address <= memory.ROMBankNEnd || (memory.ExternalRAMStart <= write.Address && write.Address <= memory.ExternalRAMEnd) {
+			cartridge.Store(write.Address, write.Value)
+		}
+	}
+	return nil
+}
+
+func truncate(data []byte, size uint16) []byte {
+	if len(data) > int(size) {
+		return data[:size]
+	}
+	return data
+}
+
+func (m *machine) loadIO(registers [ioSize]byte) {
+	for i, val := range registers {
+		pointer := memory.IOPortsStart + uint16(i)
+		if pointer < go_gb.SoundStart || go_gb.SoundEnd < pointer {
+			m.mmu.IO().Store(pointer, val)
+		}
+	}
+	m.mmu.SetBooted(go_gb.Bit(registers[go_gb.BOOT-memory.IOPortsStart], 0))
+	m.mmu.SetDMAInProgress(false)
+
+	// power cycle the APU so wave RAM is accessible and the registers can be written without triggering channels
+	sound := func(pointer uint16) byte {
+		return registers[pointer-memory.IOPortsStart]
+	}
+	m.spu.Store(go_gb.NR52, 0x00)
+	m.spu.Store(go_gb.NR52, sound(go_gb.NR52)&0x80)
+	for pointer := go_gb.WaveRAMStart; pointer <= go_gb.WaveRAMEnd; pointer++ {
+		m.spu.Store(pointer, sound(pointer))
+	}
+	for pointer := go_gb.SoundStart; pointer < go_gb.NR52; pointer++ {
+		val := sound(pointer)
+		switch pointer {
+		case go_gb.NR14, go_gb.NR24, go_gb.NR34, go_gb.NR44:
+			val &= 0x7F
+		}
+		m.spu.Store(pointer, val)
+	}
+}
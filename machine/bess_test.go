@@ -0,0 +1,119 @@
+package machine
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	go_gb "go-gb"
+	"go-gb/memory"
+	"testing"
+)
+
+func saveBESS(t *testing.T, m *machine) []byte {
+	var buf bytes.Buffer
+	if err := m.SaveBESS(&buf); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestMachine_SaveBESS(t *testing.T) {
+	m := newMachine(t, createRom())
+	run(m, 5000)
+	data := saveBESS(t, m)
+
+	if magic := string(data[len(data)-4:]); magic != bessMagic {
+		t.Fatalf("expected footer %q, got %q", bessMagic, magic)
+	}
+	state, err := parseBESS(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.core.Major != bessMajor || state.core.PC != m.cpu.PC() || state.core.SP != m.cpu.SP() {
+		t.Errorf("unexpected CORE block %+v", state.core)
+	}
+	if state.core.RAM.Size != 0x2000 || state.core.VRAM.Size != 0x2000 || state.core.OAM.Size != 0xA0 || state.core.HRAM.Size != 0x7F {
+		t.Errorf("unexpected buffer sizes %+v", state.core)
+	}
+	first := binary.LittleEndian.Uint32(data[len(data)-bessFooterSize:])
+	if name := string(data[first : first+4]); name != "NAME" {
+		t.Errorf("expected the NAME block first, got %q", name)
+	}
+}
+
+func TestMachine_LoadBESS(t *testing.T) {
+	m := newMachine(t, createRom())
+	run(m, 5000)
+	data := saveBESS(t, m)
+
+	loaded := newMachine(t, createRom())
+	if err := loaded.LoadBESS(bytes.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+	if loaded.cpu.Registers() != m.cpu.Registers() {
+		t.Errorf("expected registers %+v, got %+v", m.cpu.Registers(), loaded.cpu.Registers())
+	}
+	if !bytes.Equal(loaded.mmu.WRAM(), m.mmu.WRAM()) {
+		t.Error("expected WRAM to be loaded")
+	}
+	if result := saveBESS(t, loaded); !bytes.Equal(result, data) {
+		t.Error("expected the loaded machine to export the same state")
+	}
+
+	if err := loaded.LoadBESS(bytes.NewReader(data[:len(data)-1])); !errors.Is(err, ErrInvalidState) {
+		t.Errorf("expected %v, got %v", ErrInvalidState, err)
+	}
+}
+
+func TestMachine_BESS_MBC(t *testing.T) {
+	rom := make([]byte, 64*1024)
+	rom[go_gb.CartridgeTypeAddr] = byte(go_gb.MbcMBC1BATTERY)
+	rom[go_gb.CartridgeROMSizeAddr] = 0x01
+	rom[go_gb.CartridgeRAMSizeAddr] = 0x02
+	rom[3*0x4000] = 0x42 // start of bank 3
+
+	m := newMachine(t, rom)
+	cartridge := m.mmu.Cartridge()
+	cartridge.Store(0x0000, 0x0A)
+	cartridge.Store(memory.ExternalRAMStart, 0x99)
+	cartridge.Store(0x2000, 0x03)
+
+	loaded := newMachine(t, rom)
+	if err := loaded.LoadBESS(bytes.NewReader(saveBESS(t, m))); err != nil {
+		t.Fatal(err)
+	}
+	if val := loaded.mmu.Cartridge().Read(memory.ROMBankNStart); val != 0x42 {
+		t.Errorf("expected ROM bank 3 to be selected, got %X", val)
+	}
+	if val := loaded.mmu.Cartridge().Read(memory.ExternalRAMStart); val != 0x99 {
+		t.Errorf("expected %X, got %X", 0x99, val)
+	}
+}
+
+func TestMachine_LoadBESS_Rollback(t *testing.T) {
+	rom := createRom()
+	rom[go_gb.CartridgeTypeAddr] = byte(go_gb.MbcMBC3TIMERRAMBATTERY)
+	rom[go_gb.CartridgeRAMSizeAddr] = 0x02
+
+	m := newMachine(t, rom)
+	m.mmu.Cartridge().Store(0x0000, 0x0A)
+	m.mmu.Cartridge().Store(memory.ExternalRAMStart, 0x99)
+	data := saveBESS(t, m)
+
+	// replaces the RTC block with one that is too small
+	i := bytes.Index(data, []byte("RTC "))
+	size := int(binary.LittleEndian.Uint32(data[i+4:]))
+	invalid := append([]byte(nil), data[:i+4]...)
+	invalid = append(invalid, 4, 0, 0, 0, 0, 0, 0, 0)
+	invalid = append(invalid, data[i+8+size:]...)
+
+	loaded := newMachine(t, rom)
+	loaded.mmu.Cartridge().Store(0x0000, 0x0A)
+	loaded.mmu.Cartridge().Store(memory.ExternalRAMStart, 0x11)
+	if err := loaded.LoadBESS(bytes.NewReader(invalid)); !errors.Is(err, ErrInvalidState) {
+		t.Errorf("expected %v, got %v", ErrInvalidState, err)
+	}
+	if val := loaded.mmu.Cartridge().Read(memory.ExternalRAMStart); val != 0x11 {
+		t.Errorf("expected the cartridge RAM to be rolled back to %X, got %X", 0x11, val)
+	}
+}
@@ -0,0 +1,160 @@
+package machine
+
+import (
+	go_gb "go-gb"
+	"go-gb/apu"
+	"go-gb/cpu"
+	"go-gb/joypad"
+	"go-gb/memory"
+	"go-gb/ppu"
+	"go-gb/serial"
+	"go-gb/timer"
+	"io"
+)
+
+type Option func(m *machine)
+
+// display receiving the rendered frames, defaults to a display that discards them
+func WithDisplay(display go_gb.Display) Option {
+	return func(m *machine) {
+		m.display = display
+	}
+}
+
+// joypad used for JOYP, defaults to a joypad without any buttons pressed
+func WithJoypad(joypad go_gb.Joypad) Option {
+	return func(m *machine) {
+		m.joypad = joypad
+	}
+}
+
+// writer receiving the bytes sent over the serial port, e.g. the results of test ROMs
+func WithSerialOutput(out io.ReadWriter) Option {
+	return func(m *machine) {
+		m.serialOutput = out
+	}
+}
+
+// renders with the pixel FIFO, slower but raster effects from mid-scanline register writes are drawn
+func WithPixelFIFO() Option {
+	return func(m *machine) {
+		m.pixelFIFO = true
+	}
+}
+
+// time source of the cartridge RTC, defaults to the wall clock, a source with a Step(go_gb.MC) method
+// like memory.NewCycleClock is stepped by the emulated machine cycles
+func WithRTCSource(source memory.TimeSource) Option {
+	return func(m *machine) {
+		m.rtcSource = source
+	}
+}
+
+type clockSource interface {
+	memory.TimeSource
+	Step(mc go_gb.MC)
+}
+
+type cpuUnit interface {
+	go_gb.Cpu
+	Registers() cpu.Registers
+	SetRegisters(r cpu.Registers)
+}
+
+type mmuUnit interface {
+	go_gb.MemoryBus
+	Cartridge() go_gb.Cartridge
+	WRAM() []byte
+	SetBooted(val bool)
+}
+
+type ppuUnit interface {
+	go_gb.PPU
+	LoadRegisters()
+}
+
+type timerUnit interface {
+	go_gb.Memory
+	LoadRegisters()
+}
+
+// the whole Game Boy with all of its components wired together
+type machine struct {
+	rom []byte
+
+	display      go_gb.Display
+	joypad       go_gb.Joypad
+	serialOutput io.ReadWriter
+	pixelFIFO    bool
+	rtcSource    memory.TimeSource
+	screen       *screen
+
+	cpu   cpuUnit
+	mmu   mmuUnit
+	ppu   ppuUnit
+	spu   go_gb.SPU
+	timer timerUnit
+
+	components []go_gb.Stateful // in save state order
+}
+
+// wires all components for the ROM, fails for ROMs that can't be loaded
+func New(rom []byte, options ...Option) (*machine, error) {
+	m := &machine{rom: rom, display: go_gb.NewNopDisplay(), joypad: joypad.NewJoypad()}
+	for _, option := range options {
+		option(m)
+	}
+
+	m.screen = &screen{Display: m.display}
+
+	mmu := memory.NewMMU()
+	if err := mmu.Init(rom, go_gb.GB, m.joypad); err != nil {
+		return nil, err
+	}
+	if joypad, ok := m.joypad.(go_gb.IOJoypad); ok {
+		joypad.Init(mmu.IO())
+	}
+	timer := timer.NewTimer(mmu.IO())
+	mmu.SetTimer(timer)
+	ppu := ppu.NewPpu(mmu, mmu.VRAM(), mmu.OAM(), mmu.IO(), m.screen, go_gb.GB)
+	ppu.UseFIFO(m.pixelFIFO)
+	mmu.SetLCD(ppu)
+	serialPort := serial.NewSerial(serial.NopSerial, nil, m.serialOutput, mmu.IO())
+	spu := apu.NewApu(mmu.IO())
+	mmu.SetSPU(spu)
+	cpu := cpu.NewCpu(mmu, ppu, timer, serialPort, spu, m.joypad)
+	if rtc, ok := mmu.Cartridge().(memory.RTCCartridge); ok && m.rtcSource != nil {
+		rtc.SetTimeSource(m.rtcSource)
+	}
+	if clock, ok := m.rtcSource.(clockSource); ok {
+		cpu.SetClock(clock)
+	}
+
+	m.cpu = cpu
+	m.mmu = mmu
+	m.ppu = ppu
+	m.spu = spu
+	m.timer = timer
+	m.components = []go_gb.Stateful{cpu, mmu, ppu, timer, serialPort, spu}
+	return m, nil
+}
+
+func (m *machine) CPU() go_gb.Cpu {
+	return m.cpu
+}
+
+func (m *machine) MMU() go_gb.MemoryBus {
+	return m.mmu
+}
+
+func (m *machine) PPU() go_gb.PPU {
+	return m.ppu
+}
+
+func (m *machine) SPU() go_gb.SPU {
+	return m.spu
+}
+
+func (m *machine) Joypad() go_gb.Joypad {
+	return m.joypad
+}
@@ -0,0 +1,105 @@
+package machine
+
+import (
+	go_gb "go-gb"
+	"go-gb/cpu"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// emulated time after which a mooneye test ROM counts as hung
+const mooneyeTimeout go_gb.MC = 10 * 1_048_576
+
+// mooneye test ROMs, they are not distributed with the repository and are skipped when missing
+var mooneyeRoms = []string{
+	"acceptance/interrupts/ie_push.gb",
+	"acceptance/ei_sequence.gb",
+	"acceptance/instr_timing.gb",
+	"acceptance/timer/div_write.gb",
+	"acceptance/timer/rapid_toggle.gb",
+	"acceptance/timer/tim00.gb",
+	"acceptance/timer/tim00_div_trigger.gb",
+	"acceptance/timer/tim01.gb",
+	"acceptance/timer/tim01_div_trigger.gb",
+	"acceptance/timer/tim10.gb",
+	"acceptance/timer/tim10_div_trigger.gb",
+	"acceptance/timer/tim11.gb",
+	"acceptance/timer/tim11_div_trigger.gb",
+	"acceptance/timer/tima_reload.gb",
+	"acceptance/timer/tima_write_reloading.gb",
+	"acceptance/timer/tma_write_reloading.gb",
+	"emulator-only/mbc1/bits_bank1.gb",
+	"emulator-only/mbc1/bits_bank2.gb",
+	"emulator-only/mbc1/bits_mode.gb",
+	"emulator-only/mbc1/bits_ramg.gb",
+	"emulator-only/mbc1/rom_512kb.gb",
+	"emulator-only/mbc1/rom_1Mb.gb",
+	"emulator-only/mbc1/rom_2Mb.gb",
+	"emulator-only/mbc1/rom_4Mb.gb",
+	"emulator-only/mbc1/rom_8Mb.gb",
+	"emulator-only/mbc1/rom_16Mb.gb",
+	"emulator-only/mbc1/ram_64kb.gb",
+	"emulator-only/mbc1/ram_256kb.gb",
+	"emulator-only/mbc1/multicart_rom_8Mb.gb",
+}
+
+// runs the ROM from the boot ROM until the LD B,B breakpoint the mooneye tests end with, false on a timeout
+func runMooneye(t *testing.T, rom []byte) (cpu.Registers, bool) {
+	m := newMachine(t, rom)
+	var cycles go_gb.MC
+	for cycles < mooneyeTimeout {
+		if m.mmu.Booted() && m.mmu.Read(m.cpu.PC()) == 0x40 {
+			return m.cpu.Registers(), true
+		}
+		cycles += m.cpu.Step()
+	}
+	return m.cpu.Registers(), false
+}
+
+// a passed test leaves the Fibonacci numbers 3, 5, 8, 13, 21 and 34 in B, C, D, E, H and L
+func checkMooneye(t *testing.T, rom []byte) {
+	registers, ok := runMooneye(t, rom)
+	if !ok {
+		t.Fatalf("expected the LD B,B breakpoint, timed out at PC %X\n", registers.PC)
+	}
+	if registers.BC != 0x0305 || registers.DE != 0x080D || registers.HL != 0x1522 {
+		t.Errorf("expected BC 0305, DE 080D and HL 1522, got BC %04X, DE %04X and HL %04X\n",
+			registers.BC, registers.DE, registers.HL)
+	}
+}
+
+func TestMachine_Mooneye(t *testing.T) {
+	for _, name := range mooneyeRoms {
+		name := name
+		t.Run(name, func(t *testing.T) {
+			rom, err := ioutil.ReadFile(filepath.Join("testdata", "mooneye", filepath.FromSlash(name)))
+			if os.IsNotExist(err) {
+				t.Skipf("copy the mooneye test suite to testdata/mooneye to run %s", name)
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			checkMooneye(t, rom)
+		})
+	}
+}
+
+// checks the harness with a ROM that passes right after the boot ROM
+func TestMachine_Mooneye_Breakpoint(t *testing.T) {
+	rom := createRom()
+	copy(rom[0x100:], []byte{0x00, 0xC3, 0x50, 0x01}) // NOP, JP $0150 over the header
+	copy(rom[go_gb.MemNintendoLogoStart:], go_gb.NintendoLogo[:])
+	copy(rom[0x150:], []byte{
+		0x06, 3, // LD B,3
+		0x0E, 5, // LD C,5
+		0x16, 8, // LD D,8
+		0x1E, 13, // LD E,13
+		0x26, 21, // LD H,21
+		0x2E, 34, // LD L,34
+		0x40,       // LD B,B
+		0x18, 0xFE, // JR -2
+	})
+	rom[go_gb.MemHeaderChecksum] = byte(go_gb.HeaderChecksum(rom).Computed)
+	checkMooneye(t, rom)
+}
@@ -0,0 +1,61 @@
+package machine
+
+import go_gb "go-gb"
+
+// machine cycles between two frames
+const CyclesPerFrame go_gb.MC = 17556
+
+// keeps a copy of the last frame drawn by the ppu and forwards it to the configured display
+type screen struct {
+	go_gb.Display
+	frame [160 * 144]byte
+	drawn bool // a frame was drawn since the last run started
+}
+
+func (s *screen) Draw(buffer []byte) {
+	copy(s.frame[:], buffer)
+	s.drawn = true
+	s.Display.Draw(buffer)
+}
+
+// returns the last drawn frame as color ids, 160 pixels per line,
+// the slice is overwritten by the following frames
+func (m *machine) Frame() []byte {
+	return m.screen.frame[:]
+}
+
+// executes a single instruction and returns the latest frame
+func (m *machine) StepInstruction() []byte {
+	m.cpu.Step()
+	return m.Frame()
+}
+
+// runs until the ppu drew the next frame, while the LCD is off it runs for the length of one frame
+func (m *machine) RunFrame() []byte {
+	m.screen.drawn = false
+	var cycles go_gb.MC
+	for !m.screen.drawn {
+		cycles += m.cpu.Step()
+		if cycles >= CyclesPerFrame && !m.ppu.Enabled() {
+			break
+		}
+	}
+	return m.Frame()
+}
+
+// runs for at least the given number of machine cycles, the last instruction is always completed
+func (m *machine) RunCycles(n go_gb.MC) []byte {
+	var cycles go_gb.MC
+	for cycles < n {
+		cycles += m.cpu.Step()
+	}
+	return m.Frame()
+}
+
+// runs until the predicate, which is checked after every instruction, returns true
+func (m *machine) RunUntil(predicate func() bool) []byte {
+	for !predicate() {
+		m.cpu.Step()
+	}
+	return m.Frame()
+}
@@ -0,0 +1,121 @@
+package machine
+
+import (
+	go_gb "go-gb"
+	"go-gb/cpu"
+	"go-gb/memory"
+	"testing"
+	"time"
+)
+
+type recordingDisplay struct {
+	frames int
+}
+
+func (d *recordingDisplay) Draw(bufferLine []byte) {
+	d.frames += 1
+}
+
+func (d *recordingDisplay) IsDrawing() bool {
+	panic("implement me")
+}
+
+// creates a machine that skipped the boot ROM and starts executing the program at 0x100
+func newBooted(t *testing.T, program []byte, options ...Option) *machine {
+	rom := createRom()
+	copy(rom[0x100:], program)
+	m := newMachine(t, rom, options...)
+	m.mmu.SetBooted(true)
+	m.cpu.SetRegisters(cpu.Registers{PC: 0x100, SP: 0xFFFE})
+	return m
+}
+
+func TestMachine_RunFrame(t *testing.T) {
+	display := &recordingDisplay{}
+	m := newBooted(t, []byte{0x18, 0xFE}, WithDisplay(display)) // JR -2 with the LCD off
+	m.RunFrame()
+	if display.frames != 0 {
+		t.Errorf("expected no frames while the LCD is off, got %d\n", display.frames)
+	}
+
+	display = &recordingDisplay{}
+	m = newBooted(t, []byte{
+		0x3E, 0x91, // LD A, 0x91
+		0xE0, 0x40, // LDH (LCDC), A
+		0x18, 0xFE, // JR -2
+	}, WithDisplay(display))
+	for i := 1; i <= 3; i++ {
+		frame := m.RunFrame()
+		if len(frame) != 160*144 {
+			t.Fatalf("expected a frame of %d pixels, got %d\n", 160*144, len(frame))
+		}
+		if display.frames != i {
+			t.Errorf("expected %d frames, got %d\n", i, display.frames)
+		}
+		if line := m.ppu.CurrentLine(); line != 144 {
+			t.Errorf("expected to stop at the start of VBlank, got line %d\n", line)
+		}
+	}
+}
+
+func TestMachine_RunFrame_PixelFIFO(t *testing.T) {
+	display := &recordingDisplay{}
+	m := newBooted(t, []byte{
+		0x3E, 0x91, // LD A, 0x91
+		0xE0, 0x40, // LDH (LCDC), A
+		0x18, 0xFE, // JR -2
+	}, WithDisplay(display), WithPixelFIFO())
+	for i := 1; i <= 2; i++ {
+		m.RunFrame()
+		if display.frames != i {
+			t.Errorf("expected %d frames, got %d\n", i, display.frames)
+		}
+		if line := m.ppu.CurrentLine(); line != 144 {
+			t.Errorf("expected to stop at the start of VBlank, got line %d\n", line)
+		}
+	}
+}
+
+func TestMachine_RunCycles(t *testing.T) {
+	m := newBooted(t, nil) // NOPs take a single cycle each
+	m.RunCycles(16)
+	if pc := m.cpu.PC(); pc != 0x110 {
+		t.Errorf("expected PC %X, got %X\n", 0x110, pc)
+	}
+	m.RunCycles(go_gb.MC(4))
+	if pc := m.cpu.PC(); pc != 0x114 {
+		t.Errorf("expected PC %X, got %X\n", 0x114, pc)
+	}
+}
+
+func TestMachine_RunUntil(t *testing.T) {
+	m := newBooted(t, nil)
+	m.RunUntil(func() bool {
+		return m.cpu.PC() == 0x120
+	})
+	if pc := m.cpu.PC(); pc != 0x120 {
+		t.Errorf("expected PC %X, got %X\n", 0x120, pc)
+	}
+	m.StepInstruction()
+	if pc := m.cpu.PC(); pc != 0x121 {
+		t.Errorf("expected PC %X, got %X\n", 0x121, pc)
+	}
+}
+
+func TestMachine_RTCSource(t *testing.T) {
+	rom := createRom()
+	rom[go_gb.CartridgeTypeAddr] = byte(go_gb.MbcMBC3TIMERBATTERY)
+	copy(rom[0x100:], []byte{0x18, 0xFE}) // JR -2
+	m := newMachine(t, rom, WithRTCSource(memory.NewCycleClock(time.Unix(0, 0))))
+	m.mmu.SetBooted(true)
+	m.cpu.SetRegisters(cpu.Registers{PC: 0x100, SP: 0xFFFE})
+
+	m.RunCycles(3 * 1_048_576) // 3 seconds
+	m.mmu.Store(0x0000, 0x0A)  // enable the RTC
+	m.mmu.Store(0x4000, memory.RTCSeconds)
+	m.mmu.Store(0x6000, 0x00)
+	m.mmu.Store(0x6000, 0x01)
+	if seconds := m.mmu.Read(0xA000); seconds != 3 {
+		t.Errorf("expected %d seconds, got %d\n", 3, seconds)
+	}
+}
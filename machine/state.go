@@ -0,0 +1,98 @@
+package machine
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	go_gb "go-gb"
+	"io"
+	"io/ioutil"
+)
+
+const (
+	stateMagic   = "GBST"
+	stateVersion = 2
+)
+
+var (
+	ErrInvalidState  = errors.New("not a save state")
+	ErrStateMismatch = errors.New("save state belongs to a different game")
+)
+
+type stateHeader struct {
+	Magic     [4]byte
+	Version   uint16
+	Checksums [3]byte // header and global checksum of the ROM
+}
+
+func (m *machine) stateHeader() stateHeader {
+	header := stateHeader{Version: stateVersion}
+	copy(header.Magic[:], stateMagic)
+	copy(header.Checksums[:], m.rom[go_gb.MemHeaderChecksum:go_gb.MemGlobalChecksum+2])
+	return header
+}
+
+// writes a snapshot of the whole machine, the cartridge ROM is not included
+func (m *machine) SaveState(w io.Writer) error {
+	header := m.stateHeader()
+	if err := go_gb.WriteState(w, &header); err != nil {
+		return err
+	}
+	for _, component := range m.components {
+		if err := component.SaveState(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// restores a snapshot written by SaveState, the machine is left untouched if the state can't be loaded
+func (m *machine) LoadState(r io.Reader) error {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	reader := bytes.NewReader(data)
+	var header stateHeader
+	if err := go_gb.ReadState(reader, &header); err != nil || string(header.Magic[:]) != stateMagic {
+		return ErrInvalidState
+	}
+	if header.Version != stateVersion {
+		return fmt.Errorf("unsupported save state version %d", header.Version)
+	}
+	if header.Checksums != m.stateHeader().Checksums {
+		return ErrStateMismatch
+	}
+
+	var backup bytes.Buffer
+	if err := m.SaveState(&backup); err != nil {
+		return err
+	}
+	err = m.loadComponents(reader)
+	if err == nil && reader.Len() != 0 {
+		err = fmt.Errorf("%d trailing bytes", reader.Len())
+	}
+	if err != nil {
+		m.restore(&backup)
+		return fmt.Errorf("%w: %v", ErrInvalidState, err)
+	}
+	return nil
+}
+
+// rolls back a failed load to a state written by SaveState
+func (m *machine) restore(backup *bytes.Buffer) {
+	backup.Next(binary.Size(stateHeader{}))
+	if err := m.loadComponents(backup); err != nil {
+		panic(err)
+	}
+}
+
+func (m *machine) loadComponents(r io.Reader) error {
+	for _, component := range m.components {
+		if err := component.LoadState(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
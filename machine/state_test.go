@@ -0,0 +1,81 @@
+package machine
+
+import (
+	"bytes"
+	"errors"
+	go_gb "go-gb"
+	"testing"
+)
+
+func createRom() []byte {
+	rom := make([]byte, 32*1024)
+	rom[go_gb.CartridgeTypeAddr] = byte(go_gb.MbcROMOnly)
+	rom[go_gb.MemGlobalChecksum] = 0x12
+	rom[go_gb.MemGlobalChecksum+1] = 0x34
+	return rom
+}
+
+func newMachine(t *testing.T, rom []byte, options ...Option) *machine {
+	m, err := New(rom, options...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func run(m *machine, instructions int) {
+	for i := 0; i < instructions; i++ {
+		m.cpu.Step()
+	}
+}
+
+func saveState(t *testing.T, m *machine) []byte {
+	var buf bytes.Buffer
+	if err := m.SaveState(&buf); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestMachine_SaveLoadState(t *testing.T) {
+	m := newMachine(t, createRom())
+	run(m, 5000)
+	saved := saveState(t, m)
+	run(m, 5000)
+	expected := saveState(t, m)
+
+	if err := m.LoadState(bytes.NewReader(saved)); err != nil {
+		t.Fatal(err)
+	}
+	if state := saveState(t, m); !bytes.Equal(state, saved) {
+		t.Fatal("expected the loaded state to match the saved state")
+	}
+	run(m, 5000)
+	if state := saveState(t, m); !bytes.Equal(state, expected) {
+		t.Error("expected the same state after running from the loaded state")
+	}
+}
+
+func TestMachine_LoadState_Invalid(t *testing.T) {
+	m := newMachine(t, createRom())
+	run(m, 1000)
+	saved := saveState(t, m)
+	run(m, 1000)
+	current := saveState(t, m)
+
+	if err := m.LoadState(bytes.NewReader(saved[:len(saved)-10])); !errors.Is(err, ErrInvalidState) {
+		t.Errorf("expected %v, got %v", ErrInvalidState, err)
+	}
+	if state := saveState(t, m); !bytes.Equal(state, current) {
+		t.Error("expected a failed load to leave the machine untouched")
+	}
+	if err := m.LoadState(bytes.NewReader([]byte("garbage"))); !errors.Is(err, ErrInvalidState) {
+		t.Errorf("expected %v, got %v", ErrInvalidState, err)
+	}
+
+	other := createRom()
+	other[go_gb.MemGlobalChecksum] = 0x56
+	if err := newMachine(t, other).LoadState(bytes.NewReader(saved)); !errors.Is(err, ErrStateMismatch) {
+		t.Errorf("expected %v, got %v", ErrStateMismatch, err)
+	}
+}
@@ -11,8 +11,15 @@ const (
 	MemCGBFlag           uint16 = 0x0143
 	MemRomSize           uint16 = 0x0148
 	MemRamSize           uint16 = 0x0149
+	MemHeaderChecksum    uint16 = 0x014D
+	MemGlobalChecksum    uint16 = 0x014E // 2 bytes, big endian
+	MemHeaderEnd         uint16 = 0x0150 // first byte after the cartridge header
 )
 
+const BOOT uint16 = 0xFF50 // writing 1 unmaps the boot ROM (W)
+
+const KEY1 uint16 = 0xFF4D // CGB speed switch, bit 7 is the current speed (R) and bit 0 prepares a switch on STOP (R/W)
+
 func ReadBytes(reader Reader, pointer uint16, n uint16) []byte {
 	result := make([]byte, n)
 	for i := uint16(0); i < n; i++ {
@@ -57,9 +64,31 @@ type RomLoader interface {
 	LoadRom(rom []byte) int
 }
 
+// battery backed external RAM (and RTC state where present) that survives power off
+type Battery interface {
+	HasBattery() bool
+	// returns a copy of the external RAM, followed by the RTC state if the cartridge has a clock
+	ExportRAM() []byte
+	// restores data previously returned by ExportRAM
+	ImportRAM(data []byte) error
+}
+
 type Cartridge interface {
 	Memory
 	RomLoader
+	Battery
+	Stateful // bank registers and RAM
+}
+
+// implemented by frontends that want to be notified about the rumble motor state
+type Rumble interface {
+	SetRumble(on bool)
+}
+
+// implemented by cartridges with a rumble motor
+type RumbleCartridge interface {
+	Cartridge
+	SubscribeRumble(rumble Rumble)
 }
 
 type MemoryBus interface {
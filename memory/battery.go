@@ -0,0 +1,23 @@
+package memory
+
+import (
+	"errors"
+	"fmt"
+)
+
+var ErrSaveTooSmall = errors.New("save data is smaller than the cartridge RAM")
+
+func exportRAM(ram []byte) []byte {
+	result := make([]byte, len(ram))
+	copy(result, ram)
+	return result
+}
+
+// copies the save data into the RAM, trailing data (e.g. a footer written by another emulator) is ignored
+func importRAM(ram, data []byte) error {
+	if len(data) < len(ram) {
+		return fmt.Errorf("%w: got %d bytes, want %d", ErrSaveTooSmall, len(data), len(ram))
+	}
+	copy(ram, data)
+	return nil
+}
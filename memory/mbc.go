@@ -1,8 +1,10 @@
 package memory
 
 import (
+	"bytes"
 	"fmt"
 	go_gb "go-gb"
+	"io"
 )
 
 const (
@@ -10,9 +12,48 @@ const (
 	KiB = 1 << 10
 )
 
+// a write to a cartridge register
+type RegisterWrite struct {
+	Address uint16
+	Value   byte
+}
+
+// implemented by cartridges that can describe their bank registers as the writes that restore them
+type RegisterCartridge interface {
+	go_gb.Cartridge
+	RegisterWrites() []RegisterWrite
+}
+
+// gives direct access to every external RAM bank regardless of the selected one, e.g. for cheats
+type BankedRAMCartridge interface {
+	go_gb.Cartridge
+	// stores into the RAM bank at A000-BFFF, banks and addresses past the RAM size are mirrored
+	StoreRAM(bank byte, pointer uint16, val byte)
+}
+
+func storeRAM(ram []byte, bank byte, pointer uint16, val byte) {
+	if len(ram) == 0 {
+		return
+	}
+	ram[ramAddress(ram, bank, pointer)] = val
+}
+
+// returns the offset into the RAM for the pointer at A000-BFFF, banks and addresses past the RAM size are mirrored
+func ramAddress(ram []byte, bank byte, pointer uint16) uint {
+	return (uint(bank)*uint(ExternalRAMEnd-ExternalRAMStart+1) + uint(pointer-ExternalRAMStart)) % uint(len(ram))
+}
+
+func ramEnableValue(enabled bool) byte {
+	if enabled {
+		return 0x0A
+	}
+	return 0x00
+}
+
 type noMBC struct {
-	rom [ROMBankNEnd + 1]byte
-	ram []byte
+	rom     [ROMBankNEnd + 1]byte
+	ram     []byte
+	battery bool
 }
 
 func (m *noMBC) ReadBytes(pointer, n uint16) []byte {
@@ -72,79 +113,576 @@ func (m *noMBC) LoadRom(bytes []byte) int {
 	return n
 }
 
+func (m *noMBC) HasBattery() bool {
+	return m.battery && m.ram != nil
+}
+
+func (m *noMBC) ExportRAM() []byte {
+	return exportRAM(m.ram)
+}
+
+func (m *noMBC) ImportRAM(data []byte) error {
+	return importRAM(m.ram, data)
+}
+
+func (m *noMBC) StoreRAM(bank byte, pointer uint16, val byte) {
+	storeRAM(m.ram, 0, pointer, val)
+}
+
+func (m *noMBC) SaveState(w io.Writer) error {
+	return go_gb.WriteState(w, m.ram)
+}
+
+func (m *noMBC) LoadState(r io.Reader) error {
+	return go_gb.ReadState(r, m.ram)
+}
+
+func (m *noMBC) RegisterWrites() []RegisterWrite {
+	return nil
+}
+
 type mbc1 struct {
 	romBank   *bank
 	ramBank   *bank
 	ramEnable bool
 
-	selectedRomBank byte
-	selectedRamBank byte
-	ramBankingMode  bool
+	bank1 byte // 5 bits, lower ROM bank bits
+	bank2 byte // 2 bits, upper ROM bank bits or RAM bank
+	mode  bool // if set, bank2 also applies to the 0000-3FFF window and the RAM bank
+
+	multicart bool // MBC1M wiring, bank1 only uses 4 bits and bank2 is shifted by 4
+
+	battery bool
 }
 
-func NewMbc1(romBank *bank, ramBank *bank) *mbc1 {
-	return &mbc1{romBank: romBank, ramBank: ramBank, selectedRomBank: 1, selectedRamBank: 1}
+func NewMbc1(romBank *bank, ramBank *bank, battery bool) *mbc1 {
+	return &mbc1{romBank: romBank, ramBank: ramBank, bank1: 1, battery: battery}
 }
 
 func (m *mbc1) ReadBytes(pointer, n uint16) []byte {
 	return go_gb.ReadBytes(m, pointer, n)
 }
 
+func (m *mbc1) bank2Shift() byte {
+	if m.multicart {
+		return 4
+	}
+	return 5
+}
+
+// returns the ROM bank mapped to 0000-3FFF
+func (m *mbc1) romBank0() uint16 {
+	if !m.mode {
+		return 0
+	}
+	return uint16(m.bank2<<m.bank2Shift()) % uint16(m.romBank.numOfParts)
+}
+
+// returns the ROM bank mapped to 4000-7FFF
+func (m *mbc1) romBankN() uint16 {
+	bank1 := m.bank1
+	if m.multicart {
+		bank1 &= 0x0F
+	}
+	return uint16(m.bank2<<m.bank2Shift()|bank1) % uint16(m.romBank.numOfParts)
+}
+
+// returns the offset into the RAM for the given pointer, RAM smaller than a bank is mirrored
+func (m *mbc1) ramAddress(pointer uint16) uint {
+	var bank uint
+	if m.mode {
+		bank = uint(m.bank2)
+	}
+	return (bank*uint(ExternalRAMEnd-ExternalRAMStart+1) + uint(pointer-ExternalRAMStart)) % uint(len(m.ramBank.memory))
+}
+
 func (m *mbc1) Read(pointer uint16) byte {
 	if pointer <= ROMBank0End {
-		return m.romBank.Read(0, pointer)
+		return m.romBank.Read(m.romBank0(), pointer)
 	} else if pointer <= ROMBankNEnd {
-		return m.romBank.Read(uint16(m.selectedRomBank), pointer-ROMBankNStart)
+		return m.romBank.Read(m.romBankN(), pointer-ROMBankNStart)
 	} else if ExternalRAMStart <= pointer && pointer <= ExternalRAMEnd {
-		if !m.ramEnable {
+		if !m.ramEnable || m.ramBank == nil {
 			return 0xFF
 		}
-		if m.ramBankingMode {
-			return m.ramBank.Read(uint16(m.selectedRamBank), pointer-ExternalRAMStart)
-		}
-		return m.ramBank.Read(0, pointer-ExternalRAMStart)
+		return m.ramBank.memory[m.ramAddress(pointer)]
 	}
 	panic(fmt.Errorf("invalid address %X", pointer))
 }
 
 func (m *mbc1) StoreBytes(pointer uint16, bytes []byte) {
-	val := go_gb.FromBytes(bytes)
+	go_gb.WriteBytes(m, pointer, bytes)
+}
+
+func (m *mbc1) Store(pointer uint16, val byte) {
 	if pointer <= 0x1FFF {
-		m.ramEnable = val&0xFF == 0x0A
+		m.ramEnable = val&0x0F == 0x0A
 	} else if pointer <= ROMBank0End {
-		val := byte(val & 0x1F)
-		m.selectedRomBank = (m.selectedRomBank & 0xE0) | val
-		switch m.selectedRomBank {
-		case 0x00, 0x20, 0x40, 0x60:
-			m.selectedRomBank += 1
+		m.bank1 = val & 0x1F
+		if m.bank1 == 0 { // checked on all 5 bits, even on multicarts
+			m.bank1 = 1
 		}
-		//fmt.Printf("selected ROM bank %d\n", m.selectedRomBank)
 	} else if pointer <= 0x5FFF {
-		val &= 0x03
-		if m.ramBankingMode {
-			m.selectedRamBank = byte(val)
-			//fmt.Printf("selected RAM bank %d\n", m.selectedRamBank)
+		m.bank2 = val & 0x03
+	} else if pointer <= ROMBankNEnd {
+		m.mode = val&0x01 == 0x01
+	} else if ExternalRAMStart <= pointer && pointer <= ExternalRAMEnd {
+		if m.ramEnable && m.ramBank != nil {
+			m.ramBank.memory[m.ramAddress(pointer)] = val
+		}
+	}
+}
+
+func (m *mbc1) LoadRom(bytes []byte) int {
+	n := m.romBank.LoadRom(bytes)
+	m.multicart = m.isMulticart()
+	return n
+}
+
+// MBC1M multicarts are 1 MiB ROMs holding several games of 256 KiB,
+// each game starts with its own header so the Nintendo logo shows up again in bank 0x10
+func (m *mbc1) isMulticart() bool {
+	if m.romBank.numOfParts != 64 {
+		return false
+	}
+	logo := m.romBank.memory[go_gb.MemNintendoLogoStart : go_gb.MemNintendoLogoEnd+1]
+	offset := 0x10 * m.romBank.partSize
+	return bytes.Equal(logo, m.romBank.memory[offset+uint(go_gb.MemNintendoLogoStart):offset+uint(go_gb.MemNintendoLogoEnd)+1])
+}
+
+func (m *mbc1) HasBattery() bool {
+	return m.battery && m.ramBank != nil
+}
+
+func (m *mbc1) ExportRAM() []byte {
+	if m.ramBank == nil {
+		return nil
+	}
+	return exportRAM(m.ramBank.memory)
+}
+
+func (m *mbc1) ImportRAM(data []byte) error {
+	if m.ramBank == nil {
+		return nil
+	}
+	return importRAM(m.ramBank.memory, data)
+}
+
+func (m *mbc1) StoreRAM(bank byte, pointer uint16, val byte) {
+	storeRAM(m.ramBank.Memory(), bank, pointer, val)
+}
+
+func (m *mbc1) SaveState(w io.Writer) error {
+	return go_gb.WriteState(w, &m.ramEnable, &m.bank1, &m.bank2, &m.mode, m.ramBank.Memory())
+}
+
+func (m *mbc1) LoadState(r io.Reader) error {
+	return go_gb.ReadState(r, &m.ramEnable, &m.bank1, &m.bank2, &m.mode, m.ramBank.Memory())
+}
+
+func (m *mbc1) RegisterWrites() []RegisterWrite {
+	return []RegisterWrite{
+		{0x0000, ramEnableValue(m.ramEnable)},
+		{0x2000, m.bank1},
+		{0x4000, m.bank2},
+		{0x6000, go_gb.BitToByte(m.mode)},
+	}
+}
+
+type mbc2 struct {
+	romBank   *bank
+	ram       [512]byte // only the lower nibble is used
+	ramEnable bool
+
+	selectedRomBank byte
+
+	battery bool
+}
+
+func NewMbc2(romBank *bank, battery bool) *mbc2 {
+	return &mbc2{romBank: romBank, selectedRomBank: 1, battery: battery}
+}
+
+func (m *mbc2) ReadBytes(pointer, n uint16) []byte {
+	return go_gb.ReadBytes(m, pointer, n)
+}
+
+func (m *mbc2) Read(pointer uint16) byte {
+	if pointer <= ROMBank0End {
+		return m.romBank.Read(0, pointer)
+	} else if pointer <= ROMBankNEnd {
+		return m.romBank.Read(uint16(m.selectedRomBank)%uint16(m.romBank.numOfParts), pointer-ROMBankNStart)
+	} else if ExternalRAMStart <= pointer && pointer <= ExternalRAMEnd {
+		if !m.ramEnable {
+			return 0xFF
+		}
+		// the 512 half-bytes are echoed across the whole external RAM area, upper bits read as 1s
+		return 0xF0 | m.ram[(pointer-ExternalRAMStart)&0x1FF]
+	}
+	panic(fmt.Errorf("invalid address %X", pointer))
+}
+
+func (m *mbc2) StoreBytes(pointer uint16, bytes []byte) {
+	go_gb.WriteBytes(m, pointer, bytes)
+}
+
+func (m *mbc2) Store(pointer uint16, val byte) {
+	if pointer <= ROMBank0End {
+		// address bit 8 selects between RAM enable (0) and ROM bank selection (1)
+		if pointer&0x100 == 0 {
+			m.ramEnable = val&0x0F == 0x0A
 		} else {
-			m.selectedRomBank |= byte(val << 5)
-			switch m.selectedRomBank {
-			case 0x00, 0x20, 0x40, 0x60:
-				m.selectedRomBank += 1
+			m.selectedRomBank = val & 0x0F
+			if m.selectedRomBank == 0 {
+				m.selectedRomBank = 1
 			}
-			//fmt.Printf("upper: selected ROM bank %d\n", m.selectedRomBank)
 		}
+	} else if ExternalRAMStart <= pointer && pointer <= ExternalRAMEnd {
+		if m.ramEnable {
+			m.ram[(pointer-ExternalRAMStart)&0x1FF] = val & 0x0F
+		}
+	}
+}
+
+func (m *mbc2) LoadRom(bytes []byte) int {
+	return m.romBank.LoadRom(bytes)
+}
+
+func (m *mbc2) HasBattery() bool {
+	return m.battery
+}
+
+func (m *mbc2) ExportRAM() []byte {
+	return exportRAM(m.ram[:])
+}
+
+func (m *mbc2) ImportRAM(data []byte) error {
+	if err := importRAM(m.ram[:], data); err != nil {
+		return err
+	}
+	for i := range m.ram {
+		m.ram[i] &= 0x0F
+	}
+	return nil
+}
+
+func (m *mbc2) StoreRAM(bank byte, pointer uint16, val byte) {
+	storeRAM(m.ram[:], 0, pointer, val&0x0F)
+}
+
+func (m *mbc2) SaveState(w io.Writer) error {
+	return go_gb.WriteState(w, &m.ramEnable, &m.selectedRomBank, &m.ram)
+}
+
+func (m *mbc2) LoadState(r io.Reader) error {
+	return go_gb.ReadState(r, &m.ramEnable, &m.selectedRomBank, &m.ram)
+}
+
+func (m *mbc2) RegisterWrites() []RegisterWrite {
+	return []RegisterWrite{
+		{0x0000, ramEnableValue(m.ramEnable)},
+		{0x0100, m.selectedRomBank},
+	}
+}
+
+// implemented by cartridges with a real-time clock
+type RTCCartridge interface {
+	go_gb.Cartridge
+	SetTimeSource(source TimeSource)
+	// clock state in the VBA/BGB save footer format, nil if the cartridge has no clock
+	ExportRTC() []byte
+	ImportRTC(data []byte) error
+}
+
+type mbc3 struct {
+	romBank   *bank
+	ramBank   *bank
+	rtc       *rtc // nil if the cartridge has no timer
+	ramEnable bool // enables both RAM and RTC registers
+
+	selectedRomBank byte
+	selectedRamBank byte // 0x00-0x03 selects a RAM bank, 0x08-0x0C an RTC register
+
+	battery bool
+}
+
+func NewMbc3(romBank *bank, ramBank *bank, timer bool, battery bool) *mbc3 {
+	m := &mbc3{romBank: romBank, ramBank: ramBank, selectedRomBank: 1, battery: battery}
+	if timer {
+		m.rtc = newRtc(WallClock)
+	}
+	return m
+}
+
+func (m *mbc3) SetTimeSource(source TimeSource) {
+	if m.rtc != nil {
+		m.rtc.setTimeSource(source)
+	}
+}
+
+func (m *mbc3) ReadBytes(pointer, n uint16) []byte {
+	return go_gb.ReadBytes(m, pointer, n)
+}
+
+func (m *mbc3) Read(pointer uint16) byte {
+	if pointer <= ROMBank0End {
+		return m.romBank.Read(0, pointer)
 	} else if pointer <= ROMBankNEnd {
-		m.ramBankingMode = val&0x01 == 0x01
-	} else {
-		if m.ramBank != nil && m.ramEnable {
-			m.ramBank.StoreBytes(uint16(m.selectedRamBank), pointer-ExternalRAMStart, bytes)
+		return m.romBank.Read(uint16(m.selectedRomBank)%uint16(m.romBank.numOfParts), pointer-ROMBankNStart)
+	} else if ExternalRAMStart <= pointer && pointer <= ExternalRAMEnd {
+		if !m.ramEnable {
+			return 0xFF
 		}
+		if m.selectedRamBank >= RTCSeconds {
+			if m.rtc == nil {
+				return 0xFF
+			}
+			return m.rtc.read(m.selectedRamBank)
+		}
+		if m.ramBank == nil {
+			return 0xFF
+		}
+		return m.ramBank.memory[ramAddress(m.ramBank.memory, m.selectedRamBank, pointer)]
 	}
+	panic(fmt.Errorf("invalid address %X", pointer))
 }
 
-func (m *mbc1) Store(pointer uint16, val byte) {
-	m.StoreBytes(pointer, []byte{val})
+func (m *mbc3) StoreBytes(pointer uint16, bytes []byte) {
+	go_gb.WriteBytes(m, pointer, bytes)
 }
 
-func (m *mbc1) LoadRom(bytes []byte) int {
+func (m *mbc3) Store(pointer uint16, val byte) {
+	if pointer <= 0x1FFF {
+		m.ramEnable = val&0x0F == 0x0A
+	} else if pointer <= ROMBank0End {
+		m.selectedRomBank = val & 0x7F
+		if m.selectedRomBank == 0 {
+			m.selectedRomBank = 1
+		}
+	} else if pointer <= 0x5FFF {
+		m.selectedRamBank = val
+	} else if pointer <= ROMBankNEnd {
+		if m.rtc != nil {
+			m.rtc.latch(val)
+		}
+	} else if ExternalRAMStart <= pointer && pointer <= ExternalRAMEnd {
+		if !m.ramEnable {
+			return
+		}
+		if m.selectedRamBank >= RTCSeconds {
+			if m.rtc != nil {
+				m.rtc.write(m.selectedRamBank, val)
+			}
+			return
+		}
+		if m.ramBank != nil {
+			m.ramBank.memory[ramAddress(m.ramBank.memory, m.selectedRamBank, pointer)] = val
+		}
+	}
+}
+
+func (m *mbc3) LoadRom(bytes []byte) int {
 	return m.romBank.LoadRom(bytes)
 }
+
+func (m *mbc3) HasBattery() bool {
+	return m.battery
+}
+
+func (m *mbc3) ExportRAM() []byte {
+	var result []byte
+	if m.ramBank != nil {
+		result = exportRAM(m.ramBank.memory)
+	}
+	if m.rtc != nil {
+		result = append(result, m.rtc.export()...)
+	}
+	return result
+}
+
+func (m *mbc3) ImportRAM(data []byte) error {
+	if m.ramBank != nil {
+		if err := importRAM(m.ramBank.memory, data); err != nil {
+			return err
+		}
+		data = data[len(m.ramBank.memory):]
+	}
+	if m.rtc != nil && len(data) > 0 {
+		return m.rtc.load(data)
+	}
+	return nil
+}
+
+func (m *mbc3) StoreRAM(bank byte, pointer uint16, val byte) {
+	storeRAM(m.ramBank.Memory(), bank, pointer, val)
+}
+
+func (m *mbc3) SaveState(w io.Writer) error {
+	if err := go_gb.WriteState(w, &m.ramEnable, &m.selectedRomBank, &m.selectedRamBank, m.ramBank.Memory()); err != nil {
+		return err
+	}
+	if m.rtc != nil {
+		return m.rtc.saveState(w)
+	}
+	return nil
+}
+
+func (m *mbc3) LoadState(r io.Reader) error {
+	if err := go_gb.ReadState(r, &m.ramEnable, &m.selectedRomBank, &m.selectedRamBank, m.ramBank.Memory()); err != nil {
+		return err
+	}
+	if m.rtc != nil {
+		return m.rtc.loadState(r)
+	}
+	return nil
+}
+
+func (m *mbc3) RegisterWrites() []RegisterWrite {
+	return []RegisterWrite{
+		{0x0000, ramEnableValue(m.ramEnable)},
+		{0x2000, m.selectedRomBank},
+		{0x4000, m.selectedRamBank},
+	}
+}
+
+func (m *mbc3) ExportRTC() []byte {
+	if m.rtc == nil {
+		return nil
+	}
+	return m.rtc.export()
+}
+
+func (m *mbc3) ImportRTC(data []byte) error {
+	if m.rtc == nil {
+		return nil
+	}
+	return m.rtc.load(data)
+}
+
+type mbc5 struct {
+	romBank   *bank
+	ramBank   *bank
+	ramEnable bool
+
+	selectedRomBank uint16 // 9 bits
+	selectedRamBank byte
+
+	battery bool
+
+	hasRumble   bool
+	rumbleOn    bool
+	subscribers []go_gb.Rumble
+}
+
+func NewMbc5(romBank *bank, ramBank *bank, battery bool, rumble bool) *mbc5 {
+	return &mbc5{romBank: romBank, ramBank: ramBank, selectedRomBank: 1, battery: battery, hasRumble: rumble}
+}
+
+func (m *mbc5) SubscribeRumble(rumble go_gb.Rumble) {
+	m.subscribers = append(m.subscribers, rumble)
+}
+
+func (m *mbc5) ReadBytes(pointer, n uint16) []byte {
+	return go_gb.ReadBytes(m, pointer, n)
+}
+
+func (m *mbc5) Read(pointer uint16) byte {
+	if pointer <= ROMBank0End {
+		return m.romBank.Read(0, pointer)
+	} else if pointer <= ROMBankNEnd { // unlike other MBCs, bank 0 can be mapped here
+		return m.romBank.Read(m.selectedRomBank%uint16(m.romBank.numOfParts), pointer-ROMBankNStart)
+	} else if ExternalRAMStart <= pointer && pointer <= ExternalRAMEnd {
+		if !m.ramEnable || m.ramBank == nil {
+			return 0xFF
+		}
+		return m.ramBank.memory[ramAddress(m.ramBank.memory, m.selectedRamBank, pointer)]
+	}
+	panic(fmt.Errorf("invalid address %X", pointer))
+}
+
+func (m *mbc5) StoreBytes(pointer uint16, bytes []byte) {
+	go_gb.WriteBytes(m, pointer, bytes)
+}
+
+func (m *mbc5) Store(pointer uint16, val byte) {
+	if pointer <= 0x1FFF {
+		m.ramEnable = val&0x0F == 0x0A
+	} else if pointer <= 0x2FFF {
+		m.selectedRomBank = (m.selectedRomBank & 0x100) | uint16(val)
+	} else if pointer <= ROMBank0End {
+		m.selectedRomBank = (m.selectedRomBank & 0xFF) | (uint16(val&0x01) << 8)
+	} else if pointer <= 0x5FFF {
+		if m.hasRumble { // bit 3 drives the rumble motor instead of selecting RAM banks
+			m.setRumble(go_gb.Bit(val, 3))
+			m.selectedRamBank = val & 0x07
+		} else {
+			m.selectedRamBank = val & 0x0F
+		}
+	} else if ExternalRAMStart <= pointer && pointer <= ExternalRAMEnd {
+		if m.ramEnable && m.ramBank != nil {
+			m.ramBank.memory[ramAddress(m.ramBank.memory, m.selectedRamBank, pointer)] = val
+		}
+	}
+}
+
+func (m *mbc5) setRumble(on bool) {
+	if m.rumbleOn == on {
+		return
+	}
+	m.rumbleOn = on
+	for _, subscriber := range m.subscribers {
+		subscriber.SetRumble(on)
+	}
+}
+
+func (m *mbc5) LoadRom(bytes []byte) int {
+	return m.romBank.LoadRom(bytes)
+}
+
+func (m *mbc5) HasBattery() bool {
+	return m.battery && m.ramBank != nil
+}
+
+func (m *mbc5) ExportRAM() []byte {
+	if m.ramBank == nil {
+		return nil
+	}
+	return exportRAM(m.ramBank.memory)
+}
+
+func (m *mbc5) ImportRAM(data []byte) error {
+	if m.ramBank == nil {
+		return nil
+	}
+	return importRAM(m.ramBank.memory, data)
+}
+
+func (m *mbc5) StoreRAM(bank byte, pointer uint16, val byte) {
+	storeRAM(m.ramBank.Memory(), bank, pointer, val)
+}
+
+func (m *mbc5) SaveState(w io.Writer) error {
+	return go_gb.WriteState(w, &m.ramEnable, &m.selectedRomBank, &m.selectedRamBank, &m.rumbleOn, m.ramBank.Memory())
+}
+
+func (m *mbc5) LoadState(r io.Reader) error {
+	rumbleOn := m.rumbleOn
+	if err := go_gb.ReadState(r, &m.ramEnable, &m.selectedRomBank, &m.selectedRamBank, &rumbleOn, m.ramBank.Memory()); err != nil {
+		return err
+	}
+	m.setRumble(rumbleOn)
+	return nil
+}
+
+func (m *mbc5) RegisterWrites() []RegisterWrite {
+	ramBank := m.selectedRamBank
+	if m.hasRumble {
+		go_gb.Set(&ramBank, 3, m.rumbleOn)
+	}
+	return []RegisterWrite{
+		{0x0000, ramEnableValue(m.ramEnable)},
+		{0x2000, byte(m.selectedRomBank)},
+		{0x3000, byte(m.selectedRomBank >> 8)},
+		{0x4000, ramBank},
+	}
+}
@@ -0,0 +1,455 @@
+package memory
+
+import (
+	"bytes"
+	go_gb "go-gb"
+	"testing"
+	"time"
+)
+
+// creates a ROM where every byte contains the number of its 16 KiB bank, except the last byte of each bank
+// which contains the upper bits of the bank number
+func createRom(cartridgeType go_gb.CartridgeType, romSize go_gb.RomSize, ramSize go_gb.RamSize) []byte {
+	size, _ := romSize.GetSize()
+	rom := make([]byte, size)
+	for i := range rom {
+		rom[i] = byte(i / romBankSize)
+		if i%romBankSize == romBankSize-1 {
+			rom[i] = byte(i / romBankSize >> 8)
+		}
+	}
+	rom[go_gb.CartridgeTypeAddr] = byte(cartridgeType)
+	rom[go_gb.CartridgeROMSizeAddr] = byte(romSize)
+	rom[go_gb.CartridgeRAMSizeAddr] = byte(ramSize)
+	return rom
+}
+
+func newCartridge(t *testing.T, rom []byte) go_gb.Cartridge {
+	cartridge, err := getCartridge(rom)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cartridge
+}
+
+func TestMbc1_RomBanking(t *testing.T) {
+	m := newCartridge(t, createRom(go_gb.MbcMBC1, 0x06, 0x00)) // 2 MiB
+
+	if val := m.Read(ROMBankNStart); val != 1 {
+		t.Errorf("expected bank 1 after start, got %d\n", val)
+	}
+	m.Store(0x2000, 0xE0) // only the lower 5 bits are used, 0 maps to 1
+	if val := m.Read(ROMBankNStart); val != 1 {
+		t.Errorf("expected bank 1, got %d\n", val)
+	}
+	m.Store(0x2000, 0x12)
+	m.Store(0x4000, 0x03)
+	if val := m.Read(ROMBankNStart); val != 0x72 {
+		t.Errorf("expected bank %X, got %X\n", 0x72, val)
+	}
+	if val := m.Read(0x0000); val != 0 {
+		t.Errorf("expected bank 0 in mode 0, got %X\n", val)
+	}
+	m.Store(0x6000, 0x01)
+	if val := m.Read(0x0000); val != 0x60 {
+		t.Errorf("expected bank %X in mode 1, got %X\n", 0x60, val)
+	}
+	m.Store(0x2000, 0x00) // bank 0x20 is not reachable in 4000-7FFF
+	m.Store(0x4000, 0x01)
+	if val := m.Read(ROMBankNStart); val != 0x21 {
+		t.Errorf("expected bank %X, got %X\n", 0x21, val)
+	}
+}
+
+func TestMbc1_RomBankMask(t *testing.T) {
+	m := newCartridge(t, createRom(go_gb.MbcMBC1, 0x02, 0x00)) // 128 KiB, 8 banks
+
+	m.Store(0x2000, 0x1D)
+	m.Store(0x4000, 0x02)
+	if val := m.Read(ROMBankNStart); val != 0x05 {
+		t.Errorf("expected bank %X, got %X\n", 0x05, val)
+	}
+	m.Store(0x6000, 0x01)
+	if val := m.Read(0x0000); val != 0 {
+		t.Errorf("expected bank 0, got %X\n", val)
+	}
+}
+
+func TestMbc1_RamBanking(t *testing.T) {
+	m := newCartridge(t, createRom(go_gb.MbcMBC1BATTERY, 0x02, 0x03)) // 32 KiB RAM
+
+	m.Store(ExternalRAMStart, 0x01)
+	if val := m.Read(ExternalRAMStart); val != 0xFF {
+		t.Errorf("expected disabled RAM to read %X, got %X\n", 0xFF, val)
+	}
+	m.Store(0x0000, 0x1A) // only the lower nibble is checked
+	for bank := byte(0); bank < 4; bank++ {
+		m.Store(0x4000, bank)
+		m.Store(0x6000, 0x01)
+		m.Store(ExternalRAMStart, bank+0x10)
+	}
+	m.Store(0x6000, 0x00) // mode 0 always maps RAM bank 0
+	m.Store(0x4000, 0x02)
+	if val := m.Read(ExternalRAMStart); val != 0x10 {
+		t.Errorf("expected %X, got %X\n", 0x10, val)
+	}
+	m.Store(0x6000, 0x01)
+	if val := m.Read(ExternalRAMStart); val != 0x12 {
+		t.Errorf("expected %X, got %X\n", 0x12, val)
+	}
+}
+
+func TestMbc1_SmallRam(t *testing.T) {
+	m := newCartridge(t, createRom(go_gb.MbcMBC1RAM, 0x01, 0x01)) // 2 KiB RAM
+
+	m.Store(0x0000, 0x0A)
+	m.Store(ExternalRAMStart+0x0123, 0x42)
+	for _, pointer := range []uint16{ExternalRAMStart + 0x0923, ExternalRAMStart + 0x1923} {
+		if val := m.Read(pointer); val != 0x42 {
+			t.Errorf("expected RAM to be mirrored at %X, got %X\n", pointer, val)
+		}
+	}
+	m.Store(0x4000, 0x03)
+	m.Store(0x6000, 0x01)
+	if val := m.Read(ExternalRAMStart + 0x0123); val != 0x42 {
+		t.Errorf("expected RAM bank to be ignored, got %X\n", val)
+	}
+}
+
+func TestMbc1_Multicart(t *testing.T) {
+	rom := createRom(go_gb.MbcMBC1, 0x05, 0x00) // 1 MiB
+	logo := make([]byte, go_gb.MemNintendoLogoEnd-go_gb.MemNintendoLogoStart+1)
+	for i := range logo {
+		logo[i] = byte(i)
+	}
+	for bank := 0; bank < 4; bank++ { // every game has its own header
+		copy(rom[bank*0x10*romBankSize+int(go_gb.MemNintendoLogoStart):], logo)
+	}
+	m := newCartridge(t, rom)
+
+	m.Store(0x2000, 0x12) // bit 4 is ignored
+	m.Store(0x4000, 0x01)
+	if val := m.Read(ROMBankNStart); val != 0x12 {
+		t.Errorf("expected bank %X, got %X\n", 0x12, val)
+	}
+	m.Store(0x6000, 0x01)
+	if val := m.Read(0x0000); val != 0x10 {
+		t.Errorf("expected bank %X, got %X\n", 0x10, val)
+	}
+	m.Store(0x2000, 0x10) // bank 0 check uses all 5 bits
+	if val := m.Read(ROMBankNStart); val != 0x10 {
+		t.Errorf("expected bank %X, got %X\n", 0x10, val)
+	}
+
+	single := newCartridge(t, createRom(go_gb.MbcMBC1, 0x05, 0x00))
+	single.Store(0x2000, 0x12)
+	single.Store(0x4000, 0x01)
+	if val := single.Read(ROMBankNStart); val != 0x32 {
+		t.Errorf("expected bank %X, got %X\n", 0x32, val)
+	}
+}
+
+func TestMbc2_RomBanking(t *testing.T) {
+	m := newCartridge(t, createRom(go_gb.MbcMBC2, 0x03, 0x00))
+
+	if val := m.Read(ROMBankNStart); val != 1 {
+		t.Errorf("expected bank 1 after start, got %d\n", val)
+	}
+	m.Store(0x2100, 0x05)
+	if val := m.Read(ROMBankNStart); val != 5 {
+		t.Errorf("expected bank 5, got %d\n", val)
+	}
+	m.Store(0x2000, 0x07) // bit 8 not set - RAM enable register
+	if val := m.Read(ROMBankNStart); val != 5 {
+		t.Errorf("expected bank 5 to stay selected, got %d\n", val)
+	}
+	m.Store(0x0100, 0x00)
+	if val := m.Read(ROMBankNStart); val != 1 {
+		t.Errorf("expected bank 0 to map to bank 1, got %d\n", val)
+	}
+}
+
+func TestMbc2_Ram(t *testing.T) {
+	m := newCartridge(t, createRom(go_gb.MbcMBC2BATTERY, 0x03, 0x00))
+	if !m.HasBattery() {
+		t.Error("expected MBC2+BATTERY to have a battery")
+	}
+
+	m.Store(ExternalRAMStart, 0x0A)
+	if val := m.Read(ExternalRAMStart); val != 0xFF {
+		t.Errorf("expected disabled RAM to read %X, got %X\n", 0xFF, val)
+	}
+
+	m.Store(0x0000, 0x0A)
+	m.Store(ExternalRAMStart+0x10, 0xA5)
+	if val := m.Read(ExternalRAMStart + 0x10); val != 0xF5 {
+		t.Errorf("expected %X, got %X\n", 0xF5, val)
+	}
+	if val := m.Read(ExternalRAMStart + 0x210); val != 0xF5 {
+		t.Errorf("expected RAM to be echoed, got %X\n", val)
+	}
+	if val := m.Read(ExternalRAMEnd - 0x1FF + 0x10); val != 0xF5 {
+		t.Errorf("expected RAM to be echoed at the end, got %X\n", val)
+	}
+	if ram := m.ExportRAM(); len(ram) != 512 || ram[0x10] != 0x05 {
+		t.Errorf("invalid exported RAM")
+	}
+}
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (f *fakeClock) Now() time.Time {
+	return f.now
+}
+
+func latchRtc(m go_gb.Cartridge) {
+	m.Store(0x6000, 0x00)
+	m.Store(0x6000, 0x01)
+}
+
+func readRtc(m go_gb.Cartridge, register byte) byte {
+	m.Store(0x4000, register)
+	return m.Read(ExternalRAMStart)
+}
+
+func TestMbc3_RomBanking(t *testing.T) {
+	m := newCartridge(t, createRom(go_gb.MbcMBC3, 0x06, 0x00))
+	m.Store(0x2000, 0x7F)
+	if val := m.Read(ROMBankNStart); val != 0x7F {
+		t.Errorf("expected bank %d, got %d\n", 0x7F, val)
+	}
+	m.Store(0x2000, 0x00)
+	if val := m.Read(ROMBankNStart); val != 1 {
+		t.Errorf("expected bank 0 to map to bank 1, got %d\n", val)
+	}
+}
+
+func TestMbc1_OddRomSize(t *testing.T) {
+	for _, romSize := range []go_gb.RomSize{0x52, 0x53, 0x54} {
+		m := newCartridge(t, createRom(go_gb.MbcMBC1, romSize, 0x00))
+		m.Store(0x2000, 0x11)
+		if val := m.Read(ROMBankNStart + romBankSize - 2); val != 0x11 { // banks are not stretched over the ROM
+			t.Errorf("ROM size %02X: expected bank %d, got %d\n", byte(romSize), 0x11, val)
+		}
+	}
+}
+
+func TestMbc3_RamBanking(t *testing.T) {
+	m := newCartridge(t, createRom(go_gb.MbcMBC3RAMBATTERY, 0x06, 0x03))
+	m.Store(0x0000, 0x0A)
+	for bank := byte(0); bank < 4; bank++ {
+		m.Store(0x4000, bank)
+		m.Store(ExternalRAMStart, bank+10)
+	}
+	for bank := byte(0); bank < 4; bank++ {
+		m.Store(0x4000, bank)
+		if val := m.Read(ExternalRAMStart); val != bank+10 {
+			t.Errorf("RAM bank %d: expected %d, got %d\n", bank, bank+10, val)
+		}
+	}
+}
+
+func TestMbc3_SmallRam(t *testing.T) {
+	m := newCartridge(t, createRom(go_gb.MbcMBC3RAMBATTERY, 0x01, 0x01)) // 2 KiB RAM
+
+	m.Store(0x0000, 0x0A)
+	m.Store(ExternalRAMStart+0x1923, 0x42)
+	for _, pointer := range []uint16{ExternalRAMStart + 0x0123, ExternalRAMStart + 0x0923} {
+		if val := m.Read(pointer); val != 0x42 {
+			t.Errorf("expected RAM to be mirrored at %X, got %X\n", pointer, val)
+		}
+	}
+	m.Store(0x4000, 0x03)
+	if val := m.Read(ExternalRAMStart + 0x0123); val != 0x42 {
+		t.Errorf("expected RAM bank to be ignored, got %X\n", val)
+	}
+}
+
+func TestMbc3_Rtc(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1000, 0)}
+	m := newCartridge(t, createRom(go_gb.MbcMBC3TIMERRAMBATTERY, 0x06, 0x03)).(RTCCartridge)
+	m.SetTimeSource(clock)
+	m.Store(0x0000, 0x0A)
+
+	clock.now = clock.now.Add(2*24*time.Hour + 3*time.Hour + 4*time.Minute + 5*time.Second)
+	if val := readRtc(m, RTCSeconds); val != 0 {
+		t.Errorf("expected latched seconds to stay 0 before latching, got %d\n", val)
+	}
+	latchRtc(m)
+	expected := map[byte]byte{RTCSeconds: 5, RTCMinutes: 4, RTCHours: 3, RTCDaysLow: 2, RTCDaysHigh: 0}
+	for register, val := range expected {
+		if result := readRtc(m, register); result != val {
+			t.Errorf("register %X: expected %d, got %d\n", register, val, result)
+		}
+	}
+
+	// halt stops the clock
+	m.Store(0x4000, RTCDaysHigh)
+	m.Store(ExternalRAMStart, 1<<rtcHaltBit)
+	clock.now = clock.now.Add(time.Hour)
+	latchRtc(m)
+	if val := readRtc(m, RTCHours); val != 3 {
+		t.Errorf("expected halted clock to keep hour %d, got %d\n", 3, val)
+	}
+
+	// day counter overflow sets the carry bit
+	m.Store(0x4000, RTCDaysLow)
+	m.Store(ExternalRAMStart, 0xFF)
+	m.Store(0x4000, RTCDaysHigh)
+	m.Store(ExternalRAMStart, 0x01)
+	clock.now = clock.now.Add(24 * time.Hour)
+	latchRtc(m)
+	if val := readRtc(m, RTCDaysHigh); val != 1<<rtcCarryBit {
+		t.Errorf("expected day carry, got %08b\n", val)
+	}
+	if val := readRtc(m, RTCDaysLow); val != 0 {
+		t.Errorf("expected day counter to wrap, got %d\n", val)
+	}
+}
+
+func TestMbc3_RtcSave(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1000, 0)}
+	m := newCartridge(t, createRom(go_gb.MbcMBC3TIMERRAMBATTERY, 0x06, 0x03)).(RTCCartridge)
+	m.SetTimeSource(clock)
+	m.Store(0x0000, 0x0A)
+	m.Store(0x4000, RTCMinutes)
+	m.Store(ExternalRAMStart, 10)
+
+	data := m.ExportRAM()
+	if len(data) != 32*KiB+rtcFooterSize {
+		t.Fatalf("expected %d bytes, got %d\n", 32*KiB+rtcFooterSize, len(data))
+	}
+
+	loaded := newCartridge(t, createRom(go_gb.MbcMBC3TIMERRAMBATTERY, 0x06, 0x03)).(RTCCartridge)
+	clock.now = clock.now.Add(time.Minute)
+	loaded.SetTimeSource(clock)
+	if err := loaded.ImportRAM(data); err != nil {
+		t.Fatal(err)
+	}
+	loaded.Store(0x0000, 0x0A)
+	latchRtc(loaded)
+	if val := readRtc(loaded, RTCMinutes); val != 11 {
+		t.Errorf("expected the clock to catch up to minute %d, got %d\n", 11, val)
+	}
+}
+
+func TestMbc3_State(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1000, 0)}
+	m := newCartridge(t, createRom(go_gb.MbcMBC3TIMERRAMBATTERY, 0x06, 0x03)).(RTCCartridge)
+	m.SetTimeSource(clock)
+	m.Store(0x0000, 0x0A)
+	m.Store(0x2000, 0x05)
+	m.Store(0x4000, 0x02)
+	m.Store(ExternalRAMStart, 0x42)
+	m.Store(0x4000, RTCHours)
+	m.Store(ExternalRAMStart, 3)
+
+	var buf bytes.Buffer
+	if err := m.SaveState(&buf); err != nil {
+		t.Fatal(err)
+	}
+	loaded := newCartridge(t, createRom(go_gb.MbcMBC3TIMERRAMBATTERY, 0x06, 0x03)).(RTCCartridge)
+	loaded.SetTimeSource(clock)
+	if err := loaded.LoadState(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("expected the whole state to be read, %d bytes left\n", buf.Len())
+	}
+	if val := loaded.Read(ROMBankNStart); val != 5 {
+		t.Errorf("expected bank 5, got %d\n", val)
+	}
+	latchRtc(loaded)
+	if val := readRtc(loaded, RTCHours); val != 3 {
+		t.Errorf("expected hour %d, got %d\n", 3, val)
+	}
+	loaded.Store(0x4000, 0x02)
+	if val := loaded.Read(ExternalRAMStart); val != 0x42 {
+		t.Errorf("expected %X, got %X\n", 0x42, val)
+	}
+}
+
+func TestCycleClock(t *testing.T) {
+	start := time.Unix(0, 0)
+	c := NewCycleClock(start)
+	c.Step(cpuFrequency * 3)
+	if elapsed := c.Now().Sub(start); elapsed != 3*time.Second {
+		t.Errorf("expected 3s, got %v\n", elapsed)
+	}
+}
+
+type mockRumble struct {
+	states []bool
+}
+
+func (m *mockRumble) SetRumble(on bool) {
+	m.states = append(m.states, on)
+}
+
+func TestMbc5_RomBanking(t *testing.T) {
+	m := newCartridge(t, createRom(go_gb.MbcMBC5, 0x08, 0x00))
+	m.Store(0x2000, 0x00)
+	if val := m.Read(ROMBankNStart); val != 0 {
+		t.Errorf("expected bank 0 to be selectable, got %d\n", val)
+	}
+	m.Store(0x2000, 0x2A)
+	m.Store(0x3000, 0x01)
+	if val := m.Read(ROMBankNStart); val != 0x2A {
+		t.Errorf("expected lower bank bits %X, got %X\n", 0x2A, val)
+	}
+	if val := m.Read(ROMBankNEnd); val != 0x01 {
+		t.Errorf("expected upper bank bits %X, got %X\n", 0x01, val)
+	}
+}
+
+func TestMbc5_SmallRam(t *testing.T) {
+	m := newCartridge(t, createRom(go_gb.MbcMBC5RAMBATTERY, 0x01, 0x01)) // 2 KiB RAM
+
+	m.Store(0x0000, 0x0A)
+	m.Store(ExternalRAMStart+0x1923, 0x42)
+	for _, pointer := range []uint16{ExternalRAMStart + 0x0123, ExternalRAMStart + 0x0923} {
+		if val := m.Read(pointer); val != 0x42 {
+			t.Errorf("expected RAM to be mirrored at %X, got %X\n", pointer, val)
+		}
+	}
+	m.Store(0x4000, 0x05)
+	if val := m.Read(ExternalRAMStart + 0x0123); val != 0x42 {
+		t.Errorf("expected RAM bank to be ignored, got %X\n", val)
+	}
+}
+
+func TestMbc5_Rumble(t *testing.T) {
+	m := newCartridge(t, createRom(go_gb.MbcMBC5RUMBLERAMBATTERY, 0x08, 0x04)).(go_gb.RumbleCartridge)
+	rumble := &mockRumble{}
+	m.SubscribeRumble(rumble)
+
+	m.Store(0x0000, 0x0A)
+	m.Store(0x4000, 0x09) // motor on, RAM bank 1
+	m.Store(ExternalRAMStart, 0x42)
+	m.Store(0x4000, 0x01) // motor off, RAM bank 1
+	m.Store(0x4000, 0x01)
+	if val := m.Read(ExternalRAMStart); val != 0x42 {
+		t.Errorf("expected bit 3 not to select a RAM bank, got %X\n", val)
+	}
+	if len(rumble.states) != 2 || !rumble.states[0] || rumble.states[1] {
+		t.Errorf("expected the motor to turn on and off once, got %v\n", rumble.states)
+	}
+}
+
+func TestMbc_StoreRAM(t *testing.T) {
+	m := newCartridge(t, createRom(go_gb.MbcMBC1BATTERY, 0x02, 0x03)).(BankedRAMCartridge) // 4 RAM banks
+	m.StoreRAM(2, 0xA010, 0x42)
+	m.StoreRAM(5, 0xA020, 0x43) // mirrors bank 1
+	m.Store(0x0000, 0x0A)
+	m.Store(0x6000, 0x01)
+	m.Store(0x4000, 0x02)
+	if val := m.Read(0xA010); val != 0x42 {
+		t.Errorf("expected %X, got %X\n", 0x42, val)
+	}
+	m.Store(0x4000, 0x01)
+	if val := m.Read(0xA020); val != 0x43 {
+		t.Errorf("expected %X, got %X\n", 0x43, val)
+	}
+}
@@ -16,6 +16,14 @@ func newBank(numOfParts, totalSize uint) *bank {
 	}
 }
 
+// returns the whole memory of all parts, nil for a missing bank
+func (b *bank) Memory() []byte {
+	if b == nil {
+		return nil
+	}
+	return b.memory
+}
+
 func (b *bank) address(bank, pointer uint16) uint {
 	if b.numOfParts == 1 {
 		bank = 0
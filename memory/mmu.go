@@ -3,6 +3,7 @@ package memory
 import (
 	"fmt"
 	"go-gb"
+	"io"
 )
 
 const (
@@ -35,6 +36,7 @@ type mmu struct {
 	internalMemory          [0xFFFF + 1]byte
 	bios                    go_gb.Memory
 	cartridge               go_gb.Cartridge
+	cartridgeBus            go_gb.Cartridge // cartridge as seen by the CPU, e.g. wrapped by cheats
 	vram                    go_gb.Memory
 	wram                    byteMemory
 	echo                    go_gb.Memory
@@ -45,6 +47,11 @@ type mmu struct {
 	interruptEnableRegister go_gb.Memory
 
 	joypad go_gb.Reader
+	spu    go_gb.Memory
+	timer  go_gb.Memory
+	lcd    go_gb.Memory
+
+	gbType go_gb.GameboyType
 
 	locked        *lockedMemory
 	booted        bool
@@ -72,6 +79,26 @@ func (m *mmu) SetBooted(val bool) {
 	m.booted = val
 }
 
+// routes the cartridge accesses of the bus through the wrapper, Cartridge still returns the cartridge itself
+func (m *mmu) WrapCartridge(wrapper go_gb.Cartridge) {
+	m.cartridgeBus = wrapper
+}
+
+// routes sound registers and wave RAM (FF10-FF3F) to the sound processing unit
+func (m *mmu) SetSPU(spu go_gb.Memory) {
+	m.spu = spu
+}
+
+// routes the timer registers (FF04-FF07) to the timer
+func (m *mmu) SetTimer(timer go_gb.Memory) {
+	m.timer = timer
+}
+
+// routes STAT (FF41) to the pixel processing unit
+func (m *mmu) SetLCD(lcd go_gb.Memory) {
+	m.lcd = lcd
+}
+
 // returns true if x in [start, end], false otherwise
 func inInterval(pointer, start, end uint16) bool {
 	return start <= pointer && pointer <= end
@@ -93,7 +120,12 @@ func (m *mmu) createMmap(start, end uint16) *mmap {
 	return m.createMmapWithRedirection(start, end, start, end)
 }
 
-func (m *mmu) Init(rom []byte, gbType go_gb.GameboyType, joypad go_gb.Reader) {
+// maps the memory regions and the cartridge, fails for ROMs that can't be loaded
+func (m *mmu) Init(rom []byte, gbType go_gb.GameboyType, joypad go_gb.Reader) error {
+	cartridge, err := getCartridge(rom)
+	if err != nil {
+		return err
+	}
 	var wramMemory byteMemory
 	if gbType == go_gb.CGB {
 		wramMemory = &wram{bank: newBank(8, 8*1<<12), selectedBank: 1}
@@ -101,7 +133,8 @@ func (m *mmu) Init(rom []byte, gbType go_gb.GameboyType, joypad go_gb.Reader) {
 		wramMemory = &wram{bank: newBank(2, 2*1<<12), selectedBank: 1}
 	}
 	m.bios = NewBios()
-	m.cartridge = getCartridge(rom)
+	m.cartridge = cartridge
+	m.cartridgeBus = cartridge
 	m.vram = m.createMmap(VRAMStart, VRAMEnd)
 	m.wram = wramMemory
 	m.echo = newMmap(ECHORAMStart, ECHORAMEnd, m.wram.Memory()[0:0xDDFF-WRAMBank0Start+1])
@@ -112,10 +145,12 @@ func (m *mmu) Init(rom []byte, gbType go_gb.GameboyType, joypad go_gb.Reader) {
 	m.interruptEnableRegister = m.createMmap(InterruptEnableRegister, InterruptEnableRegister)
 
 	m.joypad = joypad
+	m.gbType = gbType
 
 	m.locked = &lockedMemory{}
 
 	m.Store(go_gb.JOYP, 0b00111111)
+	return nil
 }
 
 func (m *mmu) OAM() go_gb.Memory {
@@ -135,7 +170,7 @@ func (m *mmu) Route(pointer uint16) go_gb.Memory {
 		return m.bios
 	}
 	if inInterval(pointer, ROMBank0Start, ROMBankNEnd) {
-		return m.cartridge
+		return m.cartridgeBus
 	} else if inInterval(pointer, VRAMStart, VRAMEnd) {
 		locked := m.Read(go_gb.LCDSTAT)&0x3 == 3
 		if locked {
@@ -143,7 +178,7 @@ func (m *mmu) Route(pointer uint16) go_gb.Memory {
 		}
 		return m.vram
 	} else if inInterval(pointer, ExternalRAMStart, ExternalRAMEnd) {
-		return m.cartridge
+		return m.cartridgeBus
 	} else if inInterval(pointer, WRAMBank0Start, WRAMBankNEnd) {
 		return m.wram
 	} else if inInterval(pointer, ECHORAMStart, ECHORAMEnd) {
@@ -156,6 +191,12 @@ func (m *mmu) Route(pointer uint16) go_gb.Memory {
 		return m.oam
 	} else if inInterval(pointer, UnusableStart, UnusableEnd) {
 		return m.unusable
+	} else if m.spu != nil && inInterval(pointer, go_gb.SoundStart, go_gb.SoundEnd) {
+		return m.spu
+	} else if m.timer != nil && inInterval(pointer, go_gb.TimerStart, go_gb.TimerEnd) {
+		return m.timer
+	} else if m.lcd != nil && pointer == go_gb.LCDSTAT {
+		return m.lcd
 	} else if inInterval(pointer, IOPortsStart, IOPortsEnd) {
 		return m.io
 	} else if inInterval(pointer, HRAMStart, HRAMEnd) {
@@ -192,20 +233,29 @@ func (m *mmu) Store(pointer uint16, val byte) {
 		m.io.Store(go_gb.LCDDMA, val)
 		m.dma(val)
 		return
-	case 0xFF50:
+	case go_gb.BOOT:
 		m.unmapBios(val)
 	// add on lcd turn on - write to display
 	case go_gb.DIV:
-		m.io.Store(go_gb.DIV, 0)
-		return
+		if m.timer == nil {
+			m.io.Store(go_gb.DIV, 0)
+			return
+		}
 	case go_gb.JOYP:
 		m.io.Store(go_gb.JOYP, val&0x30)
 		return
 	case go_gb.LCDSTAT:
-		m.io.Store(go_gb.LCDSTAT, (val&0xFC)|(m.io.Read(go_gb.LCDSTAT)&0x03))
-		return
+		if m.lcd == nil {
+			m.io.Store(go_gb.LCDSTAT, (val&0xFC)|(m.io.Read(go_gb.LCDSTAT)&0x03))
+			return
+		}
 	case go_gb.LCDLY: // todo: should it be reset to 0?
 		return
+	case go_gb.KEY1: // only the prepare bit is writable, the speed is switched by the CPU on STOP
+		if m.gbType == go_gb.CGB {
+			m.io.Store(go_gb.KEY1, (m.io.Read(go_gb.KEY1)&0x80)|(val&1))
+		}
+		return
 	}
 	m.Route(pointer).Store(pointer, val)
 }
@@ -231,6 +281,32 @@ func (m *mmu) unmapBios(b ...byte) {
 	}
 }
 
+// returns all WRAM banks
+func (m *mmu) WRAM() []byte {
+	return m.wram.Memory()
+}
+
+// saves the internal memory, WRAM banks, boot and DMA flags followed by the cartridge state
+func (m *mmu) SaveState(w io.Writer) error {
+	wram := m.wram.(*wram)
+	if err := go_gb.WriteState(w, m.internalMemory[:], wram.Memory(), &wram.selectedBank, &m.booted, &m.dmaInProgress); err != nil {
+		return err
+	}
+	return m.cartridge.SaveState(w)
+}
+
+func (m *mmu) LoadState(r io.Reader) error {
+	wram := m.wram.(*wram)
+	if err := go_gb.ReadState(r, m.internalMemory[:], wram.Memory(), &wram.selectedBank, &m.booted, &m.dmaInProgress); err != nil {
+		return err
+	}
+	return m.cartridge.LoadState(r)
+}
+
+func (m *mmu) Cartridge() go_gb.Cartridge {
+	return m.cartridge
+}
+
 func (m *mmu) LoadRom(rom []byte) int {
 	return m.cartridge.LoadRom(rom)
 }
@@ -1,6 +1,7 @@
 package memory
 
 import (
+	"errors"
 	go_gb "go-gb"
 	"testing"
 )
@@ -14,17 +15,28 @@ func TestMemoryBus_Read_Store(t *testing.T) {
 	b[go_gb.CartridgeTypeAddr] = 0x08    // ROM+RAM
 	b[go_gb.CartridgeROMSizeAddr] = 0x05 // 1MByte in 64 banks
 	b[go_gb.CartridgeRAMSizeAddr] = 0x03 // 32 KByte in 4 banks
-	m.Init(b[:], go_gb.GB)
+	if err := m.Init(b[:], go_gb.GB, go_gb.NOPJoypad); err != nil {
+		t.Fatal(err)
+	}
+	m.SetBooted(true)     // the boot ROM is mapped over 0x0000-0x00FF until it's unmapped
+	m.Store(0x0000, 0x0A) // enables the cartridge RAM
 
 	for i := VRAMStart; i <= VRAMEnd; i++ {
 		m.Store(i, byte(i))
 	}
 
+	// the IO registers have side effects (e.g. DMA locks the bus), they are tested on their own
 	for i := uint(ExternalRAMStart); i < 0xFFFF+1; i++ {
+		if inInterval(uint16(i), IOPortsStart, IOPortsEnd) {
+			continue
+		}
 		m.Store(uint16(i), byte(i))
 	}
 
 	for i := 0; i <= 0xFFFF; i++ {
+		if inInterval(uint16(i), IOPortsStart, IOPortsEnd) {
+			continue
+		}
 		val := m.Read(uint16(i))
 		if uint16(i) == go_gb.CartridgeTypeAddr {
 			if val != 0x08 {
@@ -53,3 +65,42 @@ func TestMemoryBus_Read_Store(t *testing.T) {
 		}
 	}
 }
+
+func TestMMU_Init_InvalidRom(t *testing.T) {
+	rom := make([]byte, 32*KiB)
+	rom[go_gb.CartridgeTypeAddr] = byte(go_gb.MbcHuC3)
+	err := NewMMU().Init(rom, go_gb.GB, go_gb.NOPJoypad)
+	var unsupported go_gb.ErrUnsupportedMapper
+	if !errors.As(err, &unsupported) || unsupported.Type != go_gb.MbcHuC3 {
+		t.Errorf("expected %v, got %v\n", go_gb.ErrUnsupportedMapper{Type: go_gb.MbcHuC3}, err)
+	}
+
+	rom[go_gb.CartridgeTypeAddr] = byte(go_gb.MbcMBC1)
+	rom[go_gb.CartridgeROMSizeAddr] = 0x42
+	if err := NewMMU().Init(rom, go_gb.GB, go_gb.NOPJoypad); !errors.Is(err, go_gb.ErrInvalidHeader) {
+		t.Errorf("expected %v, got %v\n", go_gb.ErrInvalidHeader, err)
+	}
+
+	if err := NewMMU().Init(rom[:0x100], go_gb.GB, go_gb.NOPJoypad); !errors.Is(err, go_gb.ErrTruncatedROM) {
+		t.Errorf("expected %v, got %v\n", go_gb.ErrTruncatedROM, err)
+	}
+}
+
+func TestMMU_Store_KEY1(t *testing.T) {
+	rom := make([]byte, 32*KiB)
+	for _, gbType := range []go_gb.GameboyType{go_gb.GB, go_gb.CGB} {
+		m := NewMMU()
+		if err := m.Init(rom, gbType, go_gb.NOPJoypad); err != nil {
+			t.Fatal(err)
+		}
+		m.IO().Store(go_gb.KEY1, 0x80) // double speed, set by the CPU
+		m.Store(go_gb.KEY1, 0xFF)
+		expected := byte(0x80)
+		if gbType == go_gb.CGB {
+			expected = 0x81
+		}
+		if val := m.Read(go_gb.KEY1); val != expected {
+			t.Errorf("expected %X, got %X\n", expected, val)
+		}
+	}
+}
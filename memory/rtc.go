@@ -0,0 +1,230 @@
+package memory
+
+import (
+	"encoding/binary"
+	"fmt"
+	go_gb "go-gb"
+	"io"
+	"sync"
+	"time"
+)
+
+const (
+	RTCSeconds  byte = 0x08
+	RTCMinutes  byte = 0x09
+	RTCHours    byte = 0x0A
+	RTCDaysLow  byte = 0x0B
+	RTCDaysHigh byte = 0x0C // Bit 0: day counter bit 8, Bit 6: halt, Bit 7: day counter carry
+
+	rtcHaltBit  = 6
+	rtcCarryBit = 7
+
+	// VBA/BGB compatible save footer: current and latched registers as uint32 followed by an uint64 UNIX timestamp
+	rtcFooterSize = 5*4 + 5*4 + 8
+
+	cpuFrequency = 4_194_304 / 4 // M cycles per second
+)
+
+// source of time for the real-time clock
+type TimeSource interface {
+	Now() time.Time
+}
+
+type wallClock struct {
+}
+
+var WallClock TimeSource = wallClock{}
+
+func (w wallClock) Now() time.Time {
+	return time.Now()
+}
+
+// time source driven by emulated cycles, makes the RTC deterministic
+type cycleClock struct {
+	start  time.Time
+	cycles go_gb.MC
+	mutex  sync.Mutex
+}
+
+func NewCycleClock(start time.Time) *cycleClock {
+	return &cycleClock{start: start}
+}
+
+func (c *cycleClock) Step(mc go_gb.MC) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.cycles += mc
+}
+
+func (c *cycleClock) Now() time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	seconds := c.cycles / cpuFrequency
+	rest := c.cycles % cpuFrequency
+	return c.start.Add(time.Duration(seconds)*time.Second + time.Duration(rest)*time.Second/cpuFrequency)
+}
+
+type rtcRegisters struct {
+	seconds, minutes, hours byte
+	days                    uint16
+	halt, carry             bool
+}
+
+func (r *rtcRegisters) read(register byte) byte {
+	switch register {
+	case RTCSeconds:
+		return r.seconds
+	case RTCMinutes:
+		return r.minutes
+	case RTCHours:
+		return r.hours
+	case RTCDaysLow:
+		return byte(r.days)
+	case RTCDaysHigh:
+		result := byte(r.days>>8) & 0x01
+		go_gb.Set(&result, rtcHaltBit, r.halt)
+		go_gb.Set(&result, rtcCarryBit, r.carry)
+		return result
+	}
+	return 0xFF
+}
+
+func (r *rtcRegisters) write(register, val byte) {
+	switch register {
+	case RTCSeconds:
+		r.seconds = val & 0x3F
+	case RTCMinutes:
+		r.minutes = val & 0x3F
+	case RTCHours:
+		r.hours = val & 0x1F
+	case RTCDaysLow:
+		r.days = (r.days & 0x100) | uint16(val)
+	case RTCDaysHigh:
+		r.days = (r.days & 0xFF) | (uint16(val&0x01) << 8)
+		r.halt = go_gb.Bit(val, rtcHaltBit)
+		r.carry = go_gb.Bit(val, rtcCarryBit)
+	}
+}
+
+func (r *rtcRegisters) state() []interface{} {
+	return []interface{}{&r.seconds, &r.minutes, &r.hours, &r.days, &r.halt, &r.carry}
+}
+
+func (r *rtcRegisters) advance(seconds int64) {
+	total := int64(r.seconds) + seconds
+	r.seconds = byte(total % 60)
+	total = int64(r.minutes) + total/60
+	r.minutes = byte(total % 60)
+	total = int64(r.hours) + total/60
+	r.hours = byte(total % 24)
+	total = int64(r.days) + total/24
+	if total > 0x1FF {
+		r.carry = true
+	}
+	r.days = uint16(total % 0x200)
+}
+
+// MBC3 real-time clock
+type rtc struct {
+	source TimeSource
+
+	current    rtcRegisters
+	latched    rtcRegisters
+	lastUpdate time.Time
+	latchState byte // last value written to the latch register
+}
+
+func newRtc(source TimeSource) *rtc {
+	return &rtc{source: source, lastUpdate: source.Now(), latchState: 0xFF}
+}
+
+func (r *rtc) setTimeSource(source TimeSource) {
+	r.update()
+	r.source = source
+	r.lastUpdate = source.Now()
+}
+
+// moves the clock forward by the whole seconds elapsed since the last update
+func (r *rtc) update() {
+	now := r.source.Now()
+	if r.current.halt {
+		r.lastUpdate = now
+		return
+	}
+	elapsed := int64(now.Sub(r.lastUpdate) / time.Second)
+	if elapsed <= 0 {
+		return
+	}
+	r.current.advance(elapsed)
+	r.lastUpdate = r.lastUpdate.Add(time.Duration(elapsed) * time.Second)
+}
+
+// latches the current time on a 0 -> 1 write
+func (r *rtc) latch(val byte) {
+	if r.latchState == 0x00 && val == 0x01 {
+		r.update()
+		r.latched = r.current
+	}
+	r.latchState = val
+}
+
+func (r *rtc) read(register byte) byte {
+	return r.latched.read(register)
+}
+
+func (r *rtc) write(register, val byte) {
+	r.update()
+	r.current.write(register, val)
+	if register == RTCSeconds {
+		r.lastUpdate = r.source.Now() // writing seconds resets the sub-second counter
+	}
+}
+
+func (r *rtc) export() []byte {
+	r.update()
+	footer := make([]byte, rtcFooterSize)
+	for i, regs := range [...]*rtcRegisters{&r.current, &r.latched} {
+		for j, register := range [...]byte{RTCSeconds, RTCMinutes, RTCHours, RTCDaysLow, RTCDaysHigh} {
+			binary.LittleEndian.PutUint32(footer[(i*5+j)*4:], uint32(regs.read(register)))
+		}
+	}
+	binary.LittleEndian.PutUint64(footer[40:], uint64(r.lastUpdate.Unix()))
+	return footer
+}
+
+// restores the clock from the save footer and catches up with the time that passed since it was saved
+func (r *rtc) load(footer []byte) error {
+	if len(footer) < rtcFooterSize-4 { // some emulators store a 32-bit timestamp
+		return fmt.Errorf("invalid RTC footer size %d", len(footer))
+	}
+	for i, regs := range [...]*rtcRegisters{&r.current, &r.latched} {
+		for j, register := range [...]byte{RTCSeconds, RTCMinutes, RTCHours, RTCDaysLow, RTCDaysHigh} {
+			regs.write(register, byte(binary.LittleEndian.Uint32(footer[(i*5+j)*4:])))
+		}
+	}
+	var timestamp int64
+	if len(footer) >= rtcFooterSize {
+		timestamp = int64(binary.LittleEndian.Uint64(footer[40:]))
+	} else {
+		timestamp = int64(binary.LittleEndian.Uint32(footer[40:]))
+	}
+	r.lastUpdate = time.Unix(timestamp, 0)
+	r.update()
+	return nil
+}
+
+func (r *rtc) saveState(w io.Writer) error {
+	lastUpdate := r.lastUpdate.UnixNano()
+	values := append(append(r.current.state(), r.latched.state()...), &lastUpdate, &r.latchState)
+	return go_gb.WriteState(w, values...)
+}
+
+func (r *rtc) loadState(rd io.Reader) error {
+	var lastUpdate int64
+	values := append(append(r.current.state(), r.latched.state()...), &lastUpdate, &r.latchState)
+	if err := go_gb.ReadState(rd, values...); err != nil {
+		return err
+	}
+	r.lastUpdate = time.Unix(0, lastUpdate)
+	return nil
+}
@@ -1,39 +1,62 @@
 package memory
 
 import (
-	"fmt"
 	"go-gb"
 )
 
-func getCartridge(memory []byte) go_gb.Cartridge {
+const romBankSize = 16 * KiB
+
+func getCartridge(memory []byte) (go_gb.Cartridge, error) {
+	if err := go_gb.ValidateRom(memory); err != nil {
+		return nil, err
+	}
 	cartridgeType := memory[go_gb.CartridgeTypeAddr]
 	var mbc go_gb.Cartridge
 	switch cartridgeType {
 	case 0x00:
 		mbc = &noMBC{}
 	case 0x01:
-		mbc = NewMbc1(getRomBanks(memory), nil)
-	case 0x02, 0x03: // todo: implement battery (save in files)
-		mbc = NewMbc1(getRomBanks(memory), getRamBanks(memory))
+		mbc = NewMbc1(getRomBanks(memory), nil, false)
+	case 0x02, 0x03:
+		mbc = NewMbc1(getRomBanks(memory), getRamBanks(memory), cartridgeType == 0x03)
 	case 0x05, 0x06:
-		panic("implement MBC2")
+		mbc = NewMbc2(getRomBanks(memory), cartridgeType == 0x06)
 	case 0x08, 0x09:
-		mbc = &noMBC{ram: make([]byte, ExternalRAMEnd-ExternalRAMStart+1)}
+		mbc = &noMBC{ram: make([]byte, ExternalRAMEnd-ExternalRAMStart+1), battery: cartridgeType == 0x09}
+	case 0x0F, 0x10, 0x11, 0x12, 0x13:
+		var ram *bank
+		if cartridgeType == 0x10 || cartridgeType == 0x12 || cartridgeType == 0x13 {
+			ram = getRamBanks(memory)
+		}
+		timer := cartridgeType == 0x0F || cartridgeType == 0x10
+		mbc = NewMbc3(getRomBanks(memory), ram, timer, cartridgeType != 0x11 && cartridgeType != 0x12)
+	case 0x19, 0x1A, 0x1B, 0x1C, 0x1D, 0x1E:
+		var ram *bank
+		if cartridgeType != 0x19 && cartridgeType != 0x1C {
+			ram = getRamBanks(memory)
+		}
+		battery := cartridgeType == 0x1B || cartridgeType == 0x1E
+		mbc = NewMbc5(getRomBanks(memory), ram, battery, cartridgeType >= 0x1C)
 	default:
-		panic(fmt.Errorf("implement cartridge type %X", cartridgeType))
+		return nil, go_gb.ErrUnsupportedMapper{Type: go_gb.CartridgeType(cartridgeType)}
 	}
 	mbc.LoadRom(memory)
-	return mbc
+	return mbc, nil
 }
 
 func getRomBanks(memory []byte) *bank {
 	banks := go_gb.RomSize(memory[go_gb.CartridgeROMSizeAddr])
-	size, num := banks.GetSize()
-	return newBank(num, size)
+	size, _ := banks.GetSize()
+	// banks are always 16 KiB, the header counts 32 KiB ROMs as a single bank
+	num := (size + romBankSize - 1) / romBankSize
+	return newBank(num, num*romBankSize)
 }
 
 func getRamBanks(memory []byte) *bank {
 	val := go_gb.RamSize(memory[go_gb.CartridgeRAMSizeAddr])
 	size, num := val.GetSize()
+	if num == 0 {
+		return nil
+	}
 	return newBank(num, size)
 }
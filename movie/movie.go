@@ -0,0 +1,299 @@
+package movie
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	go_gb "go-gb"
+	"go-gb/joypad"
+	"go-gb/memory"
+	"io"
+	"io/ioutil"
+	"time"
+)
+
+const (
+	magic   = "GBMV"
+	version = 2
+
+	startPowerOn byte = 0
+	startState   byte = 1
+)
+
+var (
+	ErrInvalidMovie   = errors.New("not a movie")
+	ErrRomMismatch    = errors.New("movie was recorded with a different ROM")
+	ErrSRAMMismatch   = errors.New("cartridge RAM differs from the one the movie was recorded with")
+	ErrMissingState   = errors.New("movie starts from a save state but the machine can't load it")
+	ErrNotStarted     = errors.New("recording or playback was not started")
+	ErrAlreadyStarted = errors.New("playback was already started")
+)
+
+// source of the buttons held by the player, e.g. a joypad driven by a frontend
+type Input interface {
+	Buttons() go_gb.Button
+}
+
+// time source of the cartridge RTC during recording and playback, the cpu has to step it
+type Clock interface {
+	memory.TimeSource
+	Step(mc go_gb.MC)
+}
+
+// recorded inputs and the state they start from
+type movie struct {
+	romHash  [sha256.Size]byte
+	start    byte
+	sramHash [sha256.Size]byte // power-on movies only, without the RTC
+	state    []byte            // save state movies only
+	rtcStart int64             // UNIX time the cycle driven RTC starts at
+	rtc      []byte            // RTC registers of power-on movies
+
+	frames []go_gb.Button // buttons held during each frame
+}
+
+func (m *movie) Frames() int {
+	return len(m.frames)
+}
+
+func (m *movie) Save(w io.Writer) error {
+	header := [4]byte{}
+	copy(header[:], magic)
+	stateSize := uint32(len(m.state))
+	rtcSize := uint32(len(m.rtc))
+	frameCount := uint32(len(m.frames))
+	if err := go_gb.WriteState(w, &header, uint16(version), &m.romHash, &m.start, &m.sramHash, &stateSize, m.state,
+		&m.rtcStart, &rtcSize, m.rtc, &frameCount); err != nil {
+		return err
+	}
+	frames := make([]byte, len(m.frames))
+	for i, buttons := range m.frames {
+		frames[i] = byte(buttons)
+	}
+	_, err := w.Write(frames)
+	return err
+}
+
+func Load(r io.Reader) (*movie, error) {
+	m := &movie{}
+	var header [4]byte
+	var movieVersion uint16
+	if err := go_gb.ReadState(r, &header, &movieVersion); err != nil || string(header[:]) != magic {
+		return nil, ErrInvalidMovie
+	}
+	if movieVersion != version {
+		return nil, fmt.Errorf("unsupported movie version %d", movieVersion)
+	}
+	var stateSize uint32
+	if err := go_gb.ReadState(r, &m.romHash, &m.start, &m.sramHash, &stateSize); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidMovie, err)
+	}
+	m.state = make([]byte, stateSize)
+	var rtcSize uint32
+	if err := go_gb.ReadState(r, m.state, &m.rtcStart, &rtcSize); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidMovie, err)
+	}
+	if rtcSize > 0x100 {
+		return nil, fmt.Errorf("%w: invalid RTC size %d", ErrInvalidMovie, rtcSize)
+	}
+	m.rtc = make([]byte, rtcSize)
+	var frameCount uint32
+	if err := go_gb.ReadState(r, m.rtc, &frameCount); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidMovie, err)
+	}
+	frames, err := ioutil.ReadAll(io.LimitReader(r, int64(frameCount)))
+	if err != nil {
+		return nil, err
+	}
+	if len(frames) != int(frameCount) {
+		return nil, fmt.Errorf("%w: expected %d frames, got %d", ErrInvalidMovie, frameCount, len(frames))
+	}
+	m.frames = make([]go_gb.Button, frameCount)
+	for i, buttons := range frames {
+		m.frames[i] = go_gb.Button(buttons)
+	}
+	return m, nil
+}
+
+type coreJoypad interface {
+	go_gb.IOJoypad
+	SetState(buttons go_gb.Button)
+	Buttons() go_gb.Button
+}
+
+// joypad that only changes the buttons between frames, which makes the input reproducible
+type latchedJoypad struct {
+	coreJoypad
+}
+
+func newLatchedJoypad() latchedJoypad {
+	return latchedJoypad{joypad.NewJoypad()}
+}
+
+func (l *latchedJoypad) latch(buttons go_gb.Button) {
+	l.SetState(buttons)
+}
+
+// the wall clock would make the RTC differ on every run, it's driven by the emulated cycles from the given time instead
+func cycleClock(cartridge go_gb.Battery, start int64) Clock {
+	clock := memory.NewCycleClock(time.Unix(start, 0))
+	if rtc, ok := cartridge.(memory.RTCCartridge); ok {
+		rtc.SetTimeSource(clock)
+	}
+	return clock
+}
+
+// returns the cartridge RAM without the RTC
+func sram(cartridge go_gb.Battery) []byte {
+	ram := cartridge.ExportRAM()
+	if rtc, ok := cartridge.(memory.RTCCartridge); ok {
+		ram = ram[:len(ram)-len(rtc.ExportRTC())]
+	}
+	return ram
+}
+
+func exportRTC(cartridge go_gb.Battery) []byte {
+	if rtc, ok := cartridge.(memory.RTCCartridge); ok {
+		return rtc.ExportRTC()
+	}
+	return nil
+}
+
+// records the input of every frame, used as the JOYP reader of the machine
+type recorder struct {
+	latchedJoypad
+	input Input
+
+	movie *movie
+	clock Clock
+}
+
+func NewRecorder(input Input) *recorder {
+	return &recorder{latchedJoypad: newLatchedJoypad(), input: input}
+}
+
+// starts recording from a freshly powered on machine, the cartridge RAM is hashed so the playback can check it
+// and the RTC registers are stored
+func (r *recorder) StartFromPowerOn(rom []byte, cartridge go_gb.Battery) {
+	start := time.Now().Unix()
+	r.clock = cycleClock(cartridge, start)
+	r.movie = &movie{romHash: sha256.Sum256(rom), start: startPowerOn, sramHash: sha256.Sum256(sram(cartridge)),
+		rtcStart: start, rtc: exportRTC(cartridge)}
+	r.latch(r.input.Buttons())
+}
+
+// starts recording from the current state of the machine
+func (r *recorder) StartFromState(rom []byte, cartridge go_gb.Battery, state go_gb.Stateful) error {
+	start := time.Now().Unix()
+	clock := cycleClock(cartridge, start)
+	var buf bytes.Buffer
+	if err := state.SaveState(&buf); err != nil {
+		return err
+	}
+	r.clock = clock
+	r.movie = &movie{romHash: sha256.Sum256(rom), start: startState, state: buf.Bytes(), rtcStart: start}
+	r.latch(r.input.Buttons())
+	return nil
+}
+
+// time source of the cartridge RTC while recording, it has to be stepped by the cpu
+func (r *recorder) Clock() Clock {
+	return r.clock
+}
+
+// called after every frame, stores the buttons held during the frame and latches the ones for the next one
+func (r *recorder) Frame() error {
+	if r.movie == nil {
+		return ErrNotStarted
+	}
+	r.movie.frames = append(r.movie.frames, r.latchedJoypad.Buttons())
+	r.latch(r.input.Buttons())
+	return nil
+}
+
+func (r *recorder) Movie() *movie {
+	return r.movie
+}
+
+// writes the movie recorded so far
+func (r *recorder) Save(w io.Writer) error {
+	if r.movie == nil {
+		return ErrNotStarted
+	}
+	return r.movie.Save(w)
+}
+
+// replays a movie, used as the JOYP reader of the machine
+type player struct {
+	latchedJoypad
+	movie *movie
+	frame int
+	clock Clock
+}
+
+func NewPlayer(movie *movie) *player {
+	return &player{latchedJoypad: newLatchedJoypad(), movie: movie, frame: -1}
+}
+
+// prepares the machine for playback, state is only needed for movies starting from a save state
+func (p *player) Start(rom []byte, cartridge go_gb.Battery, state go_gb.Stateful) error {
+	if p.frame >= 0 {
+		return ErrAlreadyStarted
+	}
+	if sha256.Sum256(rom) != p.movie.romHash {
+		return ErrRomMismatch
+	}
+	switch p.movie.start {
+	case startPowerOn:
+		if sha256.Sum256(sram(cartridge)) != p.movie.sramHash {
+			return ErrSRAMMismatch
+		}
+		p.clock = cycleClock(cartridge, p.movie.rtcStart)
+		if rtc, ok := cartridge.(memory.RTCCartridge); ok {
+			if err := rtc.ImportRTC(p.movie.rtc); err != nil {
+				return err
+			}
+		}
+	case startState:
+		p.clock = cycleClock(cartridge, p.movie.rtcStart) // before the state is loaded, which restores the RTC
+		if state == nil {
+			return ErrMissingState
+		}
+		if err := state.LoadState(bytes.NewReader(p.movie.state)); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("%w: unknown start %d", ErrInvalidMovie, p.movie.start)
+	}
+	p.frame = 0
+	p.latch(p.buttons())
+	return nil
+}
+
+func (p *player) buttons() go_gb.Button {
+	if p.frame < len(p.movie.frames) {
+		return p.movie.frames[p.frame]
+	}
+	return 0
+}
+
+// called after every frame, latches the buttons of the next frame, no buttons are held after the movie ended
+func (p *player) Frame() error {
+	if p.frame < 0 {
+		return ErrNotStarted
+	}
+	p.frame += 1
+	p.latch(p.buttons())
+	return nil
+}
+
+// time source of the cartridge RTC during playback, it has to be stepped by the cpu
+func (p *player) Clock() Clock {
+	return p.clock
+}
+
+// returns true once every recorded frame was played
+func (p *player) Done() bool {
+	return p.frame >= len(p.movie.frames)
+}
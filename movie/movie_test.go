@@ -0,0 +1,236 @@
+package movie
+
+import (
+	"bytes"
+	"errors"
+	go_gb "go-gb"
+	"go-gb/memory"
+	"io"
+	"testing"
+)
+
+type mockInput struct {
+	buttons go_gb.Button
+}
+
+func (m *mockInput) Buttons() go_gb.Button {
+	return m.buttons
+}
+
+type mockIO struct {
+	joyp byte
+}
+
+func (m *mockIO) ReadBytes(pointer, n uint16) []byte {
+	panic("implement me")
+}
+
+func (m *mockIO) Read(pointer uint16) byte {
+	return m.joyp
+}
+
+func (m *mockIO) StoreBytes(pointer uint16, bytes []byte) {
+	panic("implement me")
+}
+
+func (m *mockIO) Store(pointer uint16, val byte) {
+	m.joyp = val
+}
+
+type mockCartridge struct {
+	ram []byte
+}
+
+func (m *mockCartridge) HasBattery() bool {
+	return true
+}
+
+func (m *mockCartridge) ExportRAM() []byte {
+	return m.ram
+}
+
+func (m *mockCartridge) ImportRAM(data []byte) error {
+	panic("implement me")
+}
+
+type mockState struct {
+	state []byte
+}
+
+func (m *mockState) SaveState(w io.Writer) error {
+	_, err := w.Write(m.state)
+	return err
+}
+
+func (m *mockState) LoadState(r io.Reader) error {
+	var buf bytes.Buffer
+	_, err := buf.ReadFrom(r)
+	m.state = buf.Bytes()
+	return err
+}
+
+var rom = []byte{1, 2, 3, 4}
+
+func TestRecorder(t *testing.T) {
+	input := &mockInput{}
+	io := &mockIO{joyp: 0x20} // directions selected
+	recorder := NewRecorder(input)
+	recorder.Init(io)
+	if err := recorder.Frame(); err != ErrNotStarted {
+		t.Errorf("expected %v, got %v\n", ErrNotStarted, err)
+	}
+	recorder.StartFromPowerOn(rom, &mockCartridge{})
+
+	input.buttons = go_gb.ButtonLeft
+	if val := recorder.Read(go_gb.JOYP); val != 0xEF {
+		t.Errorf("expected the input to change only after the frame %X, got %X\n", 0xEF, val)
+	}
+	_ = recorder.Frame()
+	if val := recorder.Read(go_gb.JOYP); val != 0xED {
+		t.Errorf("expected %X, got %X\n", 0xED, val)
+	}
+	input.buttons = go_gb.ButtonA | go_gb.ButtonStart
+	_ = recorder.Frame()
+	io.joyp = 0x10 // buttons selected
+	if val := recorder.Read(go_gb.JOYP); val != 0xD6 {
+		t.Errorf("expected %X, got %X\n", 0xD6, val)
+	}
+	_ = recorder.Frame()
+
+	expected := []go_gb.Button{0, go_gb.ButtonLeft, go_gb.ButtonA | go_gb.ButtonStart}
+	frames := recorder.Movie().frames
+	if len(frames) != len(expected) {
+		t.Fatalf("expected %d frames, got %d\n", len(expected), len(frames))
+	}
+	for i := range expected {
+		if frames[i] != expected[i] {
+			t.Errorf("frame %d: expected %08b, got %08b\n", i, expected[i], frames[i])
+		}
+	}
+}
+
+func TestPlayer(t *testing.T) {
+	input := &mockInput{}
+	recorder := NewRecorder(input)
+	recorder.StartFromPowerOn(rom, &mockCartridge{ram: []byte{1, 2}})
+	for _, buttons := range []go_gb.Button{go_gb.ButtonUp, go_gb.ButtonB, go_gb.ButtonSelect | go_gb.ButtonDown} {
+		input.buttons = buttons
+		_ = recorder.Frame()
+	}
+	var buf bytes.Buffer
+	if err := recorder.Movie().Save(&buf); err != nil {
+		t.Fatal(err)
+	}
+	movie, err := Load(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if movie.Frames() != 3 {
+		t.Fatalf("expected %d frames, got %d\n", 3, movie.Frames())
+	}
+
+	if err := NewPlayer(movie).Start([]byte{5}, &mockCartridge{ram: []byte{1, 2}}, nil); err != ErrRomMismatch {
+		t.Errorf("expected %v, got %v\n", ErrRomMismatch, err)
+	}
+	if err := NewPlayer(movie).Start(rom, &mockCartridge{ram: []byte{1, 3}}, nil); err != ErrSRAMMismatch {
+		t.Errorf("expected %v, got %v\n", ErrSRAMMismatch, err)
+	}
+	player := NewPlayer(movie)
+	player.Init(&mockIO{joyp: 0x00})
+	if err := player.Start(rom, &mockCartridge{ram: []byte{1, 2}}, nil); err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []byte{0xC0 | 0x0F, 0xC0 | 0x0B, 0xC0 | 0x0D, 0xC0 | 0x0F} { // nothing is held after the end
+		if val := player.Read(go_gb.JOYP); val != expected {
+			t.Errorf("expected %X, got %X\n", expected, val)
+		}
+		_ = player.Frame()
+	}
+	if !player.Done() {
+		t.Error("expected the playback to be done")
+	}
+}
+
+func TestPlayer_StartState(t *testing.T) {
+	state := &mockState{state: []byte{4, 2}}
+	recorder := NewRecorder(&mockInput{})
+	if err := recorder.StartFromState(rom, &mockCartridge{}, state); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := recorder.Movie().Save(&buf); err != nil {
+		t.Fatal(err)
+	}
+	movie, err := Load(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := NewPlayer(movie).Start(rom, &mockCartridge{}, nil); err != ErrMissingState {
+		t.Errorf("expected %v, got %v\n", ErrMissingState, err)
+	}
+	loaded := &mockState{}
+	if err := NewPlayer(movie).Start(rom, &mockCartridge{}, loaded); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(loaded.state, state.state) {
+		t.Errorf("expected state %v, got %v\n", state.state, loaded.state)
+	}
+
+	if _, err := Load(bytes.NewReader([]byte("GBMV"))); !errors.Is(err, ErrInvalidMovie) {
+		t.Errorf("expected %v, got %v\n", ErrInvalidMovie, err)
+	}
+}
+
+// MBC3 cartridge with a clock whose seconds register is set to the given value
+func newRTCCartridge(t *testing.T, rom []byte, seconds byte) go_gb.Cartridge {
+	mmu := memory.NewMMU()
+	if err := mmu.Init(rom, go_gb.GB, go_gb.NOPJoypad); err != nil {
+		t.Fatal(err)
+	}
+	cartridge := mmu.Cartridge()
+	cartridge.Store(0x0000, 0x0A)
+	cartridge.Store(0x4000, memory.RTCSeconds)
+	cartridge.Store(memory.ExternalRAMStart, seconds)
+	return cartridge
+}
+
+// steps the clock by the given number of seconds and returns the latched seconds register
+func runClock(cartridge go_gb.Cartridge, clock Clock, seconds int) byte {
+	for i := 0; i < seconds; i++ {
+		clock.Step(1 << 20)
+	}
+	cartridge.Store(0x6000, 0x00)
+	cartridge.Store(0x6000, 0x01)
+	return cartridge.Read(memory.ExternalRAMStart)
+}
+
+func TestPlayer_RTC(t *testing.T) {
+	rom := make([]byte, 32*1024)
+	rom[go_gb.CartridgeTypeAddr] = byte(go_gb.MbcMBC3TIMERRAMBATTERY)
+	rom[go_gb.CartridgeRAMSizeAddr] = 0x02
+
+	recorded := newRTCCartridge(t, rom, 10)
+	recorder := NewRecorder(&mockInput{})
+	recorder.StartFromPowerOn(rom, recorded)
+	expected := runClock(recorded, recorder.Clock(), 3)
+	for i := 0; i < 3; i++ {
+		_ = recorder.Frame()
+	}
+	var buf bytes.Buffer
+	if err := recorder.Movie().Save(&buf); err != nil {
+		t.Fatal(err)
+	}
+	movie, err := Load(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	played := newRTCCartridge(t, rom, 40) // the clock of the playback machine doesn't matter
+	player := NewPlayer(movie)
+	if err := player.Start(rom, played, nil); err != nil {
+		t.Fatal(err)
+	}
+	if seconds := runClock(played, player.Clock(), 3); seconds != expected {
+		t.Errorf("expected %d seconds, got %d\n", expected, seconds)
+	}
+}
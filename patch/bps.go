@@ -0,0 +1,84 @@
+package patch
+
+import (
+	"fmt"
+	"hash/crc32"
+)
+
+const (
+	bpsSourceRead = iota
+	bpsTargetRead
+	bpsSourceCopy
+	bpsTargetCopy
+)
+
+// applies a BPS patch, the checksums of the ROM, the patch and the result are verified
+func ApplyBPS(rom, patch []byte) ([]byte, error) {
+	f, err := readFooter(patch)
+	if err != nil {
+		return nil, err
+	}
+	r := &reader{data: patch[:len(patch)-12], pos: len(bpsMagic)}
+	sourceSize, targetSize := r.sizes()
+	r.bytes(r.number()) // metadata
+	if r.err != nil {
+		return nil, r.err
+	}
+	if sourceSize != len(rom) || crc32.ChecksumIEEE(rom) != f.source {
+		return nil, ErrSourceChecksum
+	}
+
+	result := make([]byte, targetSize)
+	out, sourceOffset, targetOffset := 0, 0, 0
+	for r.remaining() > 0 {
+		data := r.number()
+		if r.err != nil {
+			return nil, r.err
+		}
+		command, length := data&3, data>>2+1
+		if length <= 0 || out+length > targetSize {
+			return nil, fmt.Errorf("%w: write past the end of the ROM", ErrInvalidPatch)
+		}
+		switch command {
+		case bpsSourceRead:
+			if out+length > len(rom) {
+				return nil, fmt.Errorf("%w: read past the end of the ROM", ErrInvalidPatch)
+			}
+			copy(result[out:], rom[out:out+length])
+		case bpsTargetRead:
+			copy(result[out:], r.bytes(length))
+		case bpsSourceCopy:
+			sourceOffset += relative(r.number())
+			if sourceOffset < 0 || sourceOffset+length > len(rom) {
+				return nil, fmt.Errorf("%w: read past the end of the ROM", ErrInvalidPatch)
+			}
+			copy(result[out:], rom[sourceOffset:sourceOffset+length])
+			sourceOffset += length
+		case bpsTargetCopy:
+			targetOffset += relative(r.number())
+			if targetOffset < 0 || targetOffset >= out {
+				return nil, fmt.Errorf("%w: copy from unwritten data", ErrInvalidPatch)
+			}
+			for i := 0; i < length; i++ { // the ranges can overlap to repeat patterns
+				result[out+i] = result[targetOffset]
+				targetOffset += 1
+			}
+		}
+		if r.err != nil {
+			return nil, r.err
+		}
+		out += length
+	}
+	if crc32.ChecksumIEEE(result) != f.target {
+		return nil, ErrTargetChecksum
+	}
+	return result, nil
+}
+
+// decodes a signed offset where the lowest bit is the sign
+func relative(data int) int {
+	if data&1 != 0 {
+		return -(data >> 1)
+	}
+	return data >> 1
+}
@@ -0,0 +1,49 @@
+package patch
+
+import "fmt"
+
+const ipsEOF = 0x454F46 // "EOF" read as an offset
+
+// applies an IPS patch, the ROM grows when records write past its end
+func ApplyIPS(rom, patch []byte) ([]byte, error) {
+	r := &reader{data: patch, pos: len(ipsMagic)}
+	result := append([]byte(nil), rom...)
+	for {
+		offset := r.bigEndian(3)
+		if r.err != nil {
+			return nil, r.err
+		}
+		if offset == ipsEOF {
+			break
+		}
+		n := r.bigEndian(2)
+		var data []byte
+		if n == 0 { // run length encoded record
+			n = r.bigEndian(2)
+			val := r.byte()
+			data = make([]byte, n)
+			for i := range data {
+				data[i] = val
+			}
+		} else {
+			data = r.bytes(n)
+		}
+		if r.err != nil {
+			return nil, r.err
+		}
+		if offset+n > len(result) {
+			result = append(result, make([]byte, offset+n-len(result))...)
+		}
+		copy(result[offset:], data)
+	}
+	switch r.remaining() {
+	case 0:
+	case 3: // truncation extension
+		if length := r.bigEndian(3); length < len(result) {
+			result = result[:length]
+		}
+	default:
+		return nil, fmt.Errorf("%w: unexpected data after EOF", ErrInvalidPatch)
+	}
+	return result, nil
+}
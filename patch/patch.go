@@ -0,0 +1,130 @@
+package patch
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	go_gb "go-gb"
+	"hash/crc32"
+	"math"
+)
+
+var (
+	ErrUnknownFormat  = errors.New("unknown patch format")
+	ErrInvalidPatch   = errors.New("invalid patch")
+	ErrSourceChecksum = errors.New("patch was made for a different ROM")
+	ErrTargetChecksum = errors.New("patched ROM has the wrong checksum")
+	ErrPatchChecksum  = errors.New("patch is corrupted")
+)
+
+const (
+	ipsMagic = "PATCH"
+	upsMagic = "UPS1"
+	bpsMagic = "BPS1"
+
+	maxSize   = 8 * go_gb.MiB // largest ROM size of the cartridge header
+	maxNumber = math.MaxInt32 // sizes, lengths and offsets of valid patches are far below, larger numbers could overflow int
+)
+
+// applies an IPS, UPS or BPS patch depending on its header, the ROM is never modified
+func Apply(rom, patch []byte) ([]byte, error) {
+	switch {
+	case bytes.HasPrefix(patch, []byte(ipsMagic)):
+		return ApplyIPS(rom, patch)
+	case bytes.HasPrefix(patch, []byte(upsMagic)):
+		return ApplyUPS(rom, patch)
+	case bytes.HasPrefix(patch, []byte(bpsMagic)):
+		return ApplyBPS(rom, patch)
+	}
+	return nil, ErrUnknownFormat
+}
+
+// reads the patch data sequentially, running past the end is reported as ErrInvalidPatch
+type reader struct {
+	data []byte
+	pos  int
+	err  error
+}
+
+func (r *reader) remaining() int {
+	return len(r.data) - r.pos
+}
+
+func (r *reader) bytes(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n < 0 || n > r.remaining() {
+		r.err = fmt.Errorf("%w: unexpected end of patch", ErrInvalidPatch)
+		return nil
+	}
+	result := r.data[r.pos : r.pos+n]
+	r.pos += n
+	return result
+}
+
+func (r *reader) byte() byte {
+	if data := r.bytes(1); data != nil {
+		return data[0]
+	}
+	return 0
+}
+
+// big endian number of n bytes used by IPS
+func (r *reader) bigEndian(n int) int {
+	result := 0
+	for i := 0; i < n; i++ {
+		result = result<<8 | int(r.byte())
+	}
+	return result
+}
+
+// variable length number used by UPS and BPS, every byte stores 7 bits and the last one has the top bit set
+func (r *reader) number() int {
+	var result, shift uint64 = 0, 1
+	for r.err == nil {
+		val := r.byte()
+		result += uint64(val&0x7F) * shift
+		if result > maxNumber {
+			r.err = fmt.Errorf("%w: number too large", ErrInvalidPatch)
+			return 0
+		}
+		if val&0x80 != 0 {
+			break
+		}
+		shift <<= 7
+		result += shift
+	}
+	return int(result)
+}
+
+// reads the source and target sizes of UPS and BPS patches
+func (r *reader) sizes() (int, int) {
+	source, target := r.number(), r.number()
+	if r.err == nil && target > maxSize {
+		r.err = fmt.Errorf("%w: patched ROM of %d bytes is too large", ErrInvalidPatch, target)
+	}
+	return source, target
+}
+
+// UPS and BPS end with the CRC32 of the source, the target and the patch itself
+type footer struct {
+	source, target, patch uint32
+}
+
+func readFooter(patch []byte) (footer, error) {
+	if len(patch) < 12 {
+		return footer{}, fmt.Errorf("%w: missing checksums", ErrInvalidPatch)
+	}
+	data := patch[len(patch)-12:]
+	f := footer{
+		source: binary.LittleEndian.Uint32(data[0:4]),
+		target: binary.LittleEndian.Uint32(data[4:8]),
+		patch:  binary.LittleEndian.Uint32(data[8:12]),
+	}
+	if crc32.ChecksumIEEE(patch[:len(patch)-4]) != f.patch {
+		return footer{}, ErrPatchChecksum
+	}
+	return f, nil
+}
@@ -0,0 +1,197 @@
+package patch
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"testing"
+)
+
+func createRom(size int) []byte {
+	rom := make([]byte, size)
+	for i := range rom {
+		rom[i] = byte(i)
+	}
+	return rom
+}
+
+func encodeNumber(val int) []byte {
+	var result []byte
+	for {
+		x := byte(val & 0x7F)
+		val >>= 7
+		if val == 0 {
+			return append(result, x|0x80)
+		}
+		result = append(result, x)
+		val -= 1
+	}
+}
+
+// appends the source, target and patch checksums
+func withFooter(patch, source, target []byte) []byte {
+	patch = append(patch, make([]byte, 8)...)
+	binary.LittleEndian.PutUint32(patch[len(patch)-8:], crc32.ChecksumIEEE(source))
+	binary.LittleEndian.PutUint32(patch[len(patch)-4:], crc32.ChecksumIEEE(target))
+	crc := make([]byte, 4)
+	binary.LittleEndian.PutUint32(crc, crc32.ChecksumIEEE(patch))
+	return append(patch, crc...)
+}
+
+func TestReader_Number(t *testing.T) {
+	for _, val := range []int{0, 1, 127, 128, 255, 16511, 16512, 1 << 20, 8 << 20} {
+		r := &reader{data: encodeNumber(val)}
+		if got := r.number(); got != val || r.err != nil || r.remaining() != 0 {
+			t.Errorf("expected %d, got %d (%v)\n", val, got, r.err)
+		}
+	}
+}
+
+func TestReader_Number_TooLarge(t *testing.T) {
+	r := &reader{data: []byte{0x7F, 0x7F, 0x7F, 0x7F, 0x7F, 0x7F, 0x7F, 0x7F, 0xFE}}
+	if got := r.number(); !errors.Is(r.err, ErrInvalidPatch) {
+		t.Errorf("expected %v, got %d (%v)\n", ErrInvalidPatch, got, r.err)
+	}
+}
+
+func TestApplyIPS(t *testing.T) {
+	rom := createRom(0x100)
+	patch := []byte(ipsMagic)
+	patch = append(patch, 0x00, 0x00, 0x10, 0x00, 0x02, 0xAA, 0xBB)       // 2 bytes at 0x10
+	patch = append(patch, 0x00, 0x00, 0x20, 0x00, 0x00, 0x00, 0x03, 0xCC) // 3 times 0xCC at 0x20
+	patch = append(patch, 0x00, 0x01, 0x00, 0x00, 0x01, 0xDD)             // grows the ROM
+	patch = append(patch, "EOF"...)
+
+	result, err := Apply(rom, patch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := createRom(0x101)
+	copy(expected[0x10:], []byte{0xAA, 0xBB})
+	copy(expected[0x20:], []byte{0xCC, 0xCC, 0xCC})
+	expected[0x100] = 0xDD
+	if !bytes.Equal(result, expected) {
+		t.Errorf("expected %X, got %X\n", expected, result)
+	}
+	if !bytes.Equal(rom, createRom(0x100)) {
+		t.Error("expected the original ROM to be unchanged")
+	}
+
+	result, err = Apply(rom, append(append([]byte(ipsMagic), "EOF"...), 0x00, 0x00, 0x80))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result) != 0x80 {
+		t.Errorf("expected the ROM to be truncated to %X bytes, got %X\n", 0x80, len(result))
+	}
+
+	if _, err := Apply(rom, append([]byte(ipsMagic), 0x00, 0x00, 0x10, 0x00, 0x05, 0xAA)); !errors.Is(err, ErrInvalidPatch) {
+		t.Errorf("expected %v, got %v\n", ErrInvalidPatch, err)
+	}
+}
+
+func TestApplyUPS(t *testing.T) {
+	rom := createRom(0x100)
+	target := createRom(0x104)
+	target[0x05] = 0xFF
+	target[0x06] = 0xFE
+	target[0x80] = 0x00 // equal to the source at 0x00, the XOR is not 0
+	copy(target[0x100:], []byte{0x11, 0x22, 0x33, 0x44})
+
+	patch := []byte(upsMagic)
+	patch = append(patch, encodeNumber(len(rom))...)
+	patch = append(patch, encodeNumber(len(target))...)
+	patch = append(patch, encodeNumber(0x05)...)
+	patch = append(patch, 0x05^0xFF, 0x06^0xFE, 0x00)
+	patch = append(patch, encodeNumber(0x80-0x08)...)
+	patch = append(patch, 0x80, 0x00)
+	patch = append(patch, encodeNumber(0x100-0x82)...)
+	patch = append(patch, 0x11, 0x22, 0x33, 0x44, 0x00)
+	patch = withFooter(patch, rom, target)
+
+	result, err := Apply(rom, patch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(result, target) {
+		t.Errorf("expected %X, got %X\n", target, result)
+	}
+
+	other := createRom(0x100)
+	other[0] = 0xFF
+	if _, err := Apply(other, patch); !errors.Is(err, ErrSourceChecksum) {
+		t.Errorf("expected %v, got %v\n", ErrSourceChecksum, err)
+	}
+	patch[len(upsMagic)+4] ^= 0xFF
+	if _, err := Apply(rom, patch); !errors.Is(err, ErrPatchChecksum) {
+		t.Errorf("expected %v, got %v\n", ErrPatchChecksum, err)
+	}
+}
+
+func TestApplyBPS(t *testing.T) {
+	rom := createRom(0x100)
+	var target []byte
+	target = append(target, rom[:0x10]...)                // source read
+	target = append(target, 0xAA, 0xBB)                   // target read
+	target = append(target, rom[0x40:0x50]...)            // source copy
+	target = append(target, 0x4E, 0x4F, 0x4E, 0x4F, 0x4E) // target copy repeating a pattern
+	target = append(target, rom[0x20:0x24]...)            // source copy backwards
+
+	action := func(command, length int) []byte {
+		return encodeNumber((length-1)<<2 | command)
+	}
+	patch := []byte(bpsMagic)
+	patch = append(patch, encodeNumber(len(rom))...)
+	patch = append(patch, encodeNumber(len(target))...)
+	patch = append(patch, encodeNumber(4)...)
+	patch = append(patch, "meta"...)
+	patch = append(patch, action(bpsSourceRead, 0x10)...)
+	patch = append(patch, action(bpsTargetRead, 2)...)
+	patch = append(patch, 0xAA, 0xBB)
+	patch = append(patch, action(bpsSourceCopy, 0x10)...)
+	patch = append(patch, encodeNumber(0x40<<1)...)
+	patch = append(patch, action(bpsTargetCopy, 5)...)
+	patch = append(patch, encodeNumber(0x20<<1)...)
+	patch = append(patch, action(bpsSourceCopy, 4)...)
+	patch = append(patch, encodeNumber((0x50-0x20)<<1|1)...)
+	patch = withFooter(patch, rom, target)
+
+	result, err := Apply(rom, patch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(result, target) {
+		t.Errorf("expected %X, got %X\n", target, result)
+	}
+
+	wrong := withFooter(patch[:len(patch)-12], rom, rom)
+	if _, err := Apply(rom, wrong); !errors.Is(err, ErrTargetChecksum) {
+		t.Errorf("expected %v, got %v\n", ErrTargetChecksum, err)
+	}
+}
+
+func TestApplyBPS_Malformed(t *testing.T) {
+	rom := createRom(0x100)
+	header := []byte(bpsMagic)
+	header = append(header, encodeNumber(len(rom))...)
+	header = append(header, encodeNumber(len(rom))...)
+	header = append(header, encodeNumber(0)...)
+
+	overflow := append([]byte{}, header...)
+	overflow = append(overflow, 0x00, 0x7F, 0x7F, 0x7F, 0x7F, 0x7F, 0x7F, 0x7F, 0xFE) // source read with a length past int
+	backwards := append([]byte{}, header...)
+	backwards = append(backwards, encodeNumber(bpsSourceCopy)...)
+	backwards = append(backwards, encodeNumber(1<<1|1)...) // source offset -1
+	for name, patch := range map[string][]byte{"overflow": overflow, "negative offset": backwards} {
+		if _, err := Apply(rom, withFooter(patch, rom, rom)); !errors.Is(err, ErrInvalidPatch) {
+			t.Errorf("%s: expected %v, got %v\n", name, ErrInvalidPatch, err)
+		}
+	}
+}
+
+func TestApply_UnknownFormat(t *testing.T) {
+	if _, err := Apply(createRom(0x100), []byte("garbage")); !errors.Is(err, ErrUnknownFormat) {
+		t.Errorf("expected %v, got %v\n", ErrUnknownFormat, err)
+	}
+}
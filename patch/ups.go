@@ -0,0 +1,48 @@
+package patch
+
+import (
+	"fmt"
+	"hash/crc32"
+)
+
+// applies an UPS patch, the checksums of the ROM, the patch and the result are verified
+func ApplyUPS(rom, patch []byte) ([]byte, error) {
+	f, err := readFooter(patch)
+	if err != nil {
+		return nil, err
+	}
+	r := &reader{data: patch[:len(patch)-12], pos: len(upsMagic)}
+	sourceSize, targetSize := r.sizes()
+	if r.err != nil {
+		return nil, r.err
+	}
+	if sourceSize != len(rom) || crc32.ChecksumIEEE(rom) != f.source {
+		return nil, ErrSourceChecksum
+	}
+
+	result := make([]byte, targetSize)
+	copy(result, rom)
+	pos := 0
+	for r.remaining() > 0 {
+		pos += r.number()
+		for r.err == nil {
+			val := r.byte()
+			if val == 0 {
+				pos += 1
+				break
+			}
+			if pos >= targetSize {
+				return nil, fmt.Errorf("%w: write past the end of the ROM", ErrInvalidPatch)
+			}
+			result[pos] ^= val
+			pos += 1
+		}
+		if r.err != nil {
+			return nil, r.err
+		}
+	}
+	if crc32.ChecksumIEEE(result) != f.target {
+		return nil, ErrTargetChecksum
+	}
+	return result, nil
+}
@@ -0,0 +1,303 @@
+package ppu
+
+import (
+	go_gb "go-gb"
+)
+
+const (
+	dotsPerLine = 456
+	oamScanDots = 80
+	maxSprites  = 10
+
+	firstFetchDelay = 6 // the first tile fetched on a line is thrown away
+
+	objPalette  = 0x04 // sprite pixels use OBP1
+	objPriority = 0x08 // BG and window colors 1-3 are drawn over the sprite pixel
+)
+
+// state of the pixel FIFO renderer, the background/window fetcher pushes 8 pixels at once
+// and the pixels are shifted out one per dot, sprites are fetched into their own FIFO and mixed on the way out
+type fifo struct {
+	fetched    [maxSprites]bool // sprites selected by the OAM scan that were fetched
+	spriteDots byte             // dots left until the sprite fetch is done, the background fetcher is paused meanwhile
+	sprite     byte             // sprite being fetched
+
+	bg      [8]byte // color indexes
+	bgCount byte
+	obj     [8]byte // color index, palette and priority, 0 for transparent pixels
+
+	fetchStep byte // tile number, low data, high data, push
+	fetchDots byte
+	fetchX    byte // tile column of the next fetch
+	tileRow   byte // row of the tile being fetched
+	tile      byte
+	low       byte
+	high      byte
+
+	delay   byte // dots before the fetcher starts
+	discard byte // pixels shifted out and discarded for fine scrolling
+	lx      byte // pixels drawn on the current line
+
+	window bool // the fetcher switched to the window on the current line
+}
+
+func (f *fifo) state() []interface{} {
+	return []interface{}{&f.fetched, &f.spriteDots, &f.sprite, &f.bg, &f.bgCount, &f.obj,
+		&f.fetchStep, &f.fetchDots, &f.fetchX, &f.tileRow, &f.tile, &f.low, &f.high, &f.delay, &f.discard, &f.lx,
+		&f.window}
+}
+
+// renders with the pixel FIFO, mode 3 takes a variable number of dots and mid-scanline register writes take effect,
+// it should be chosen before the first step
+func (p *ppu) UseFIFO(enabled bool) {
+	p.renderMutex.Lock()
+	defer p.renderMutex.Unlock()
+	p.useFIFO = enabled
+	p.resumeFIFO()
+}
+
+// restarts the current mode from its first dot
+func (p *ppu) resumeFIFO() {
+	switch p.currentMode {
+	case 0:
+		p.dot = dotsPerLine - 204
+	case 1:
+		p.dot = 0
+	case 2:
+		p.dot = 0
+	case 3:
+		p.dot = oamScanDots
+		p.scanOAM()
+		p.fifo.fetched = [maxSprites]bool{}
+		p.startLine()
+	}
+}
+
+func (p *ppu) stepFIFO(mc go_gb.MC) {
+	for i := go_gb.MC(0); i < mc*4; i++ {
+		p.stepDot()
+	}
+}
+
+func (p *ppu) stepDot() {
+	if p.currentMode == 3 {
+		p.stepPixel()
+		if p.fifo.lx == 160 {
+			p.setMode(0, 0)
+		}
+	}
+
+	p.dot += 1
+	if p.currentMode == 2 && p.dot == oamScanDots {
+		p.scanOAM()
+		p.fifo.fetched = [maxSprites]bool{}
+		p.setMode(3, 0)
+		p.startLine()
+		return
+	}
+	if p.dot < dotsPerLine {
+		return
+	}
+
+	p.dot = 0
+	if p.fifo.window {
+		p.windowLine += 1
+	}
+	p.currentLine += 1
+	if p.currentLine > 153 {
+		p.currentLine = 0
+		p.resetWindow()
+	}
+	p.updateLine()
+	switch {
+	case p.currentLine == 144:
+		p.vblankInterrupt()
+		p.setMode(1, 0)
+		p.drawFrame()
+	case p.currentLine < 144:
+		p.setMode(2, 0)
+	}
+}
+
+func (p *ppu) startLine() {
+	f := &p.fifo
+	scx, _ := p.getScroll()
+	p.triggerWindow()
+	f.bgCount = 0
+	f.obj = [8]byte{}
+	f.fetchStep = 0
+	f.fetchDots = 0
+	f.fetchX = 0
+	f.spriteDots = 0
+	f.delay = firstFetchDelay
+	f.discard = scx % 8
+	f.lx = 0
+	f.window = false
+}
+
+func (p *ppu) stepPixel() {
+	f := &p.fifo
+	if f.delay > 0 {
+		f.delay -= 1
+		return
+	}
+	if f.spriteDots > 0 {
+		f.spriteDots -= 1
+		if f.spriteDots == 0 {
+			p.fetchSprite(f.sprite)
+		}
+		return
+	}
+
+	wx, _ := p.getWindow()
+	if !f.window && p.wyTriggered && p.windowEnabled() && int(f.lx)+7 >= int(wx) {
+		f.window = true // the window restarts the fetcher, its pixels replace the fetched background
+		f.bgCount = 0
+		f.fetchStep = 0
+		f.fetchDots = 0
+		f.fetchX = 0
+		f.discard = 0
+		if wx < 7 { // the window starts left of the screen
+			f.discard = 7 - wx
+		}
+	}
+
+	p.stepFetcher()
+	if f.bgCount == 0 {
+		return
+	}
+	if f.discard == 0 && go_gb.Bit(p.io.Read(go_gb.LCDControlRegister), 1) {
+		for i := byte(0); i < p.spriteCount; i++ {
+			x := int(p.sprites[i][1])
+			if f.fetched[i] || x == 0 || x-8 > int(f.lx) {
+				continue
+			}
+			f.fetched[i] = true
+			f.sprite = i
+			f.spriteDots = 6
+			return
+		}
+	}
+	p.shiftPixel()
+}
+
+func (p *ppu) stepFetcher() {
+	f := &p.fifo
+	if f.fetchStep == 3 {
+		if f.bgCount == 0 {
+			p.pushTile()
+			f.fetchX += 1
+			f.fetchStep = 0
+		}
+		return
+	}
+	f.fetchDots += 1
+	if f.fetchDots < 2 {
+		return
+	}
+	f.fetchDots = 0
+	switch f.fetchStep {
+	case 0:
+		p.fetchTile()
+	case 1:
+		f.low = p.vram.Read(p.tileRowAddr())
+	case 2:
+		f.high = p.vram.Read(p.tileRowAddr() + 1)
+	}
+	f.fetchStep += 1
+}
+
+// reads the tile number from the background or window map with the scroll registers of this moment
+func (p *ppu) fetchTile() {
+	f := &p.fifo
+	var mapAddr uint16
+	var x, y byte
+	if f.window {
+		mapAddr = p.getWindowTileMapAddr()
+		x = f.fetchX
+		y = p.windowLine
+	} else {
+		scx, scy := p.getScroll()
+		mapAddr = p.getBgTileMapAddr()
+		x = scx/8 + f.fetchX
+		y = scy + byte(p.currentLine)
+	}
+	f.tile = p.vram.Read(mapAddr + uint16(y/8)*32 + uint16(x%32))
+	f.tileRow = y % 8
+}
+
+func (p *ppu) tileRowAddr() uint16 {
+	tileData, unsigned := p.getTileDataAddr()
+	tileId := uint16(p.fifo.tile)
+	if unsigned {
+		tileData += tileId * 16
+	} else if tileId < 128 {
+		tileData += (tileId + 128) * 16
+	} else {
+		tileData += (tileId - 128) * 16
+	}
+	return tileData + uint16(p.fifo.tileRow)*2
+}
+
+func (p *ppu) pushTile() {
+	f := &p.fifo
+	for i := range f.bg {
+		f.bg[i] = p.getColorNum(f.low, f.high, byte(7-i))
+	}
+	f.bgCount = 8
+}
+
+// mixes the fetched sprite into the sprite FIFO, pixels of sprites fetched earlier have priority
+func (p *ppu) fetchSprite(i byte) {
+	f := &p.fifo
+	sprite := p.sprites[i]
+	low, high, ok := p.spriteRow(sprite)
+	if !ok {
+		return
+	}
+
+	attributes := sprite[3]
+	var flags byte
+	if go_gb.Bit(attributes, 4) {
+		flags |= objPalette
+	}
+	if go_gb.Bit(attributes, 7) {
+		flags |= objPriority
+	}
+	offset := int(f.lx) - (int(sprite[1]) - 8) // pixels already left of the screen or drawn
+	for k := offset; k < 8; k++ {
+		color := spriteColorNum(p, low, high, attributes, k)
+		slot := k - offset
+		if color == 0 || f.obj[slot] != 0 {
+			continue
+		}
+		f.obj[slot] = color | flags
+	}
+}
+
+func (p *ppu) shiftPixel() {
+	f := &p.fifo
+	bg := f.bg[8-f.bgCount]
+	f.bgCount -= 1
+	if f.discard > 0 {
+		f.discard -= 1
+		return
+	}
+	obj := f.obj[0]
+	copy(f.obj[:], f.obj[1:])
+	f.obj[7] = 0
+
+	if !p.backgroundEnabled() {
+		bg = 0
+	}
+	color := p.getBgColor(bg)
+	if obj != 0 && (obj&objPriority == 0 || bg == 0) {
+		palette := go_gb.LCDOBP0
+		if obj&objPalette != 0 {
+			palette = go_gb.LCDOBP1
+		}
+		color = p.getSpriteColor(obj&0x03, palette)
+	}
+	p.frameBuffer[p.currentLine*160+int(f.lx)] = color
+	f.lx += 1
+}
@@ -0,0 +1,140 @@
+package ppu
+
+import (
+	go_gb "go-gb"
+	"testing"
+)
+
+type flatMemory struct {
+	bytes [0xFFFF + 1]byte
+}
+
+func (m *flatMemory) ReadBytes(pointer, n uint16) []byte {
+	return m.bytes[pointer : pointer+n]
+}
+
+func (m *flatMemory) Read(pointer uint16) byte {
+	return m.bytes[pointer]
+}
+
+func (m *flatMemory) StoreBytes(pointer uint16, bytes []byte) {
+	copy(m.bytes[pointer:], bytes)
+}
+
+func (m *flatMemory) Store(pointer uint16, val byte) {
+	m.bytes[pointer] = val
+}
+
+// ppu with the LCD and background on, tile data at 0x8000 and the identity palette
+func newTestPpu(fifo bool) (*ppu, *flatMemory) {
+	m := &flatMemory{}
+	m.Store(go_gb.LCDControlRegister, 0x93)
+	m.Store(go_gb.LCDBGP, 0xE4)
+	m.Store(go_gb.LCDOBP0, 0xE4)
+	p := NewPpu(m, m, m, m, go_gb.NewNopDisplay(), go_gb.GB)
+	p.UseFIFO(fifo)
+	return p, m
+}
+
+// dots spent in mode 3 of the current line
+func mode3Length(p *ppu) int {
+	for p.currentMode != 3 {
+		p.stepDot()
+	}
+	dots := 0
+	for p.currentMode == 3 {
+		p.stepDot()
+		dots += 1
+	}
+	return dots
+}
+
+func TestFIFO_Mode3Length(t *testing.T) {
+	for scx := byte(0); scx < 16; scx += 3 {
+		p, m := newTestPpu(true)
+		m.Store(go_gb.LCDSCX, scx)
+		if dots, expected := mode3Length(p), 172+int(scx%8); dots != expected {
+			t.Errorf("SCX %d: expected %d dots, got %d\n", scx, expected, dots)
+		}
+	}
+
+	p, m := newTestPpu(true)
+	m.StoreBytes(0xFE00, []byte{16, 8 + 20, 0, 0})
+	if dots := mode3Length(p); dots < 172+6 {
+		t.Errorf("expected the sprite to lengthen mode 3, got %d dots\n", dots)
+	}
+
+	p, m = newTestPpu(true)
+	m.Store(go_gb.LCDControlRegister, 0xB3) // window on
+	m.Store(go_gb.LCDWX, 7+40)
+	if dots := mode3Length(p); dots < 172+6 {
+		t.Errorf("expected the window to lengthen mode 3, got %d dots\n", dots)
+	}
+}
+
+func TestFIFO_MidScanlineBGP(t *testing.T) {
+	p, m := newTestPpu(true)
+	m.StoreBytes(0x8000, []byte{0xFF, 0xFF}) // tile 0 row 0 in color 3
+	for p.currentMode != 3 || p.fifo.lx < 80 {
+		p.stepDot()
+	}
+	m.Store(go_gb.LCDBGP, 0x00)
+	mode3Length(p)
+
+	for x, color := range p.frameBuffer[:160] {
+		expected := Black
+		if x >= 80 {
+			expected = White
+		}
+		if color != expected {
+			t.Fatalf("pixel %d: expected %X, got %X\n", x, expected, color)
+		}
+	}
+}
+
+func TestFIFO_Sprite(t *testing.T) {
+	p, m := newTestPpu(true)
+	m.StoreBytes(0x8010, []byte{0x81, 0x00})          // tile 1 row 0, color 1 on both edges
+	m.StoreBytes(0xFE00, []byte{16, 8 + 20, 1, 0x00}) // on top of the background
+	m.StoreBytes(0xFE04, []byte{16, 8 + 24, 1, 0x20}) // overlapping, drawn below the first sprite
+	m.StoreBytes(0xFE08, []byte{16, 4, 1, 0x00})      // partially left of the screen
+	mode3Length(p)
+
+	for x, expected := range map[int]byte{20: 1, 27: 1, 28: 0, 31: 1, 3: 1, 0: 0} {
+		if color := p.frameBuffer[x]; color != expected {
+			t.Errorf("pixel %d: expected %X, got %X\n", x, expected, color)
+		}
+	}
+}
+
+// both renderers agree on a scrolled background without raster effects, with the background on and off
+func TestFIFO_MatchesScanline(t *testing.T) {
+	for _, lcdc := range []byte{0x93, 0x92} {
+		var frames [2][]byte
+		for i, fifo := range []bool{false, true} {
+			p, m := newTestPpu(fifo)
+			m.Store(go_gb.LCDControlRegister, lcdc)
+			m.Store(go_gb.LCDSCX, 3)
+			m.Store(go_gb.LCDSCY, 5)
+			m.Store(go_gb.LCDBGP, 0x1B) // color 0 is not white
+			for tile := 0; tile < 4; tile++ {
+				for row := 0; row < 16; row++ {
+					m.Store(0x8000+uint16(tile*16+row), byte(tile*0x35+row*0x1B))
+				}
+			}
+			for j := uint16(0); j < 0x400; j++ {
+				m.Store(0x9800+j, byte(j*7)%4)
+			}
+			m.StoreBytes(0xFE00, []byte{16, 8 + 20, 3, 0x80}) // behind background colors 1-3
+			for p.currentLine < 144 {
+				p.Step(1)
+			}
+			frames[i] = p.frameBuffer[:]
+		}
+		for i := range frames[0] {
+			if frames[0][i] != frames[1][i] {
+				t.Fatalf("LCDC %X pixel %d: expected %X, got %X\n", lcdc, i, frames[0][i], frames[1][i])
+			}
+		}
+	}
+}
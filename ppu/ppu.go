@@ -3,6 +3,8 @@ package ppu
 import (
 	go_gb "go-gb"
 	"go-gb/memory"
+	"io"
+	"sort"
 	"sync"
 )
 
@@ -24,19 +26,67 @@ type ppu struct {
 	oam    go_gb.Memory // for skipping locks
 	io     go_gb.Memory // optimized access to IO
 
+	gbType go_gb.GameboyType
+
 	frameBuffer [160 * 144]byte // map colors in the display!
 
 	currentLine int
 	currentMode byte
 	modeClock   go_gb.MC
 
+	sprites     [maxSprites][4]byte // Y, X, tile and attributes of the sprites selected by the OAM scan
+	spriteCount byte
+	bgColorNums [160]byte // color indexes of the background and window on the current line
+
+	lcdOn     bool
+	skipFrame bool // the LCD was turned on during the frame
+	statLine  bool // STAT interrupt line, OR of all enabled sources
+
+	wyTriggered bool // LY matched WY in the current frame, the window can be drawn from now on
+	windowLine  byte // internal line counter of the window, only advanced on lines the window was drawn on
+
+	useFIFO bool
+	dot     int // dot of the current line, only counted by the pixel FIFO
+	fifo    fifo
+
 	renderMutex sync.Mutex
 
 	display go_gb.Display
 }
 
-func NewPpu(memory go_gb.Memory, vram go_gb.Memory, oam go_gb.Memory, io go_gb.Memory, display go_gb.Display) *ppu {
-	return &ppu{memory: memory, vram: vram, oam: oam, io: io, currentMode: 2, display: display}
+func NewPpu(memory go_gb.Memory, vram go_gb.Memory, oam go_gb.Memory, io go_gb.Memory, display go_gb.Display, gbType go_gb.GameboyType) *ppu {
+	return &ppu{memory: memory, vram: vram, oam: oam, io: io, currentMode: 2, display: display, gbType: gbType}
+}
+
+func (p *ppu) state() []interface{} {
+	return append([]interface{}{&p.frameBuffer, &p.currentLine, &p.currentMode, &p.modeClock, &p.lcdOn, &p.skipFrame, &p.statLine, &p.sprites, &p.spriteCount, &p.wyTriggered, &p.windowLine, &p.dot}, p.fifo.state()...)
+}
+
+func (p *ppu) SaveState(w io.Writer) error {
+	p.renderMutex.Lock()
+	defer p.renderMutex.Unlock()
+	return go_gb.WriteState(w, p.state()...)
+}
+
+func (p *ppu) LoadState(r io.Reader) error {
+	p.renderMutex.Lock()
+	defer p.renderMutex.Unlock()
+	return go_gb.ReadState(r, p.state()...)
+}
+
+// resumes rendering from the line and mode in LY and STAT, used when the IO registers were replaced
+func (p *ppu) LoadRegisters() {
+	p.renderMutex.Lock()
+	defer p.renderMutex.Unlock()
+	p.currentLine = int(p.io.Read(go_gb.LCDLY))
+	if p.currentLine > 153 {
+		p.currentLine = 0
+	}
+	p.currentMode = p.io.Read(go_gb.LCDSTAT) & 0x3
+	p.modeClock = 0
+	p.lcdOn = p.Enabled()
+	p.statLine = p.lcdOn && p.statSources(p.io.Read(go_gb.LCDSTAT))
+	p.resumeFIFO()
 }
 
 func (p *ppu) getBgTileMapAddr() uint16 {
@@ -69,39 +119,40 @@ func (p *ppu) windowEnabled() bool {
 	return go_gb.Bit(p.memory.Read(go_gb.LCDControlRegister), 5)
 }
 
-func (p *ppu) oamInterrupt() {
-	go_gb.Update(p.memory, go_gb.LCDSTAT, func(b byte) byte {
-		go_gb.Set(&b, 5, true)
-		return b
-	})
-	go_gb.Update(p.memory, go_gb.IF, func(b byte) byte {
-		go_gb.Set(&b, int(go_gb.BitLCD), true)
-		return b
-	})
+// the window can only be drawn once LY matched WY in the frame, checked at the start of every line
+func (p *ppu) triggerWindow() {
+	if _, wy := p.getWindow(); int(wy) == p.currentLine {
+		p.wyTriggered = true
+	}
 }
 
-func (p *ppu) hblankInterrupt() {
-	go_gb.Update(p.memory, go_gb.LCDSTAT, func(b byte) byte {
-		go_gb.Set(&b, 3, true)
-		return b
-	})
-	go_gb.Update(p.memory, go_gb.IF, func(b byte) byte {
-		go_gb.Set(&b, int(go_gb.BitLCD), true)
-		return b
-	})
+func (p *ppu) resetWindow() {
+	p.wyTriggered = false
+	p.windowLine = 0
 }
 
-func (p *ppu) requestLCDSTATInterrupt() {
-	go_gb.Update(p.io, go_gb.IF, func(b byte) byte {
-		go_gb.Set(&b, int(go_gb.BitLCD), true)
-		return b
-	})
+// STAT interrupt sources that are enabled in STAT and whose condition holds
+func (p *ppu) statSources(stat byte) bool {
+	mode := stat & 0x3
+	return go_gb.Bit(stat, go_gb.LCDSTATCoincidenceInterrupt) && go_gb.Bit(stat, go_gb.LCDSTATCoincidenceFlag) ||
+		go_gb.Bit(stat, go_gb.LCDSTATHBlankInterrupt) && mode == 0 ||
+		go_gb.Bit(stat, go_gb.LCDSTATVBlankInterrupt) && mode == 1 ||
+		go_gb.Bit(stat, go_gb.LCDSTATOAMInterruptFlag) && mode == 2
 }
 
-func (p *ppu) handleModeInterrupt(stat byte, modeBit int) {
-	if go_gb.Bit(stat, modeBit) {
-		p.requestLCDSTATInterrupt()
+// the sources are OR'ed into a single line, the interrupt is only requested on its rising edge
+func (p *ppu) setStatLine(high bool) {
+	if high && !p.statLine {
+		go_gb.Update(p.io, go_gb.IF, func(b byte) byte {
+			go_gb.Set(&b, int(go_gb.BitLCD), true)
+			return b
+		})
 	}
+	p.statLine = high
+}
+
+func (p *ppu) updateStatLine() {
+	p.setStatLine(p.lcdOn && p.statSources(p.io.Read(go_gb.LCDSTAT)))
 }
 
 func (p *ppu) vblankInterrupt() {
@@ -138,7 +189,7 @@ func (p *ppu) getWindow() (byte, byte) {
 
 func (p *ppu) setMode(mode byte, max go_gb.MC) {
 	mode &= 0x3
-	go_gb.Update(p.memory, go_gb.LCDSTAT, func(b byte) byte {
+	go_gb.Update(p.io, go_gb.LCDSTAT, func(b byte) byte {
 		return (b & 0xFC) | mode
 	})
 	p.currentMode = mode
@@ -152,12 +203,6 @@ func (p *ppu) compareLyLyc() {
 		go_gb.Set(&b, go_gb.LCDSTATCoincidenceFlag, val)
 		return b
 	})
-	if val {
-		go_gb.Update(p.memory, go_gb.IF, func(b byte) byte {
-			go_gb.Set(&b, int(go_gb.BitLCD), true)
-			return b
-		})
-	}
 }
 
 func (p *ppu) use8x16Sprites() bool {
@@ -191,37 +236,23 @@ func (p *ppu) Enabled() bool {
 
 var seen = make(map[uint16]byte)
 
-func (p *ppu) renderBackgroundScanLine() {
-	scx, scy := p.getScroll()
-	wx, wy := p.getWindow()
-
-	//scx -= 35
+// 2bpp data of the 32 tiles on a row of a tile map
+type tileRow struct {
+	low, high [32]byte
+}
 
-	line := p.getLine()
-	usingWindow := p.windowEnabled() && wy <= line
+func (r *tileRow) colorNum(p *ppu, x byte) byte {
+	return p.getColorNum(r.low[(x/8)%32], r.high[(x/8)%32], 7-x%8)
+}
 
-	var yPos byte
+func (p *ppu) readTileRow(mapAddr uint16, y byte) tileRow {
 	tileData, unsigned := p.getTileDataAddr()
-	var mapAddr uint16
-	if !usingWindow {
-		mapAddr = p.getBgTileMapAddr()
-		yPos = scy + line
-	} else {
-		mapAddr = p.getWindowTileMapAddr()
-		yPos = line - wy
-	}
-	tileRow := uint16(yPos/8) * 32
+	tileIds := p.vram.ReadBytes(mapAddr+uint16(y/8)*32, 32)
+	lineNum := uint16(y%8) * 2
 
-	tileIds := p.vram.ReadBytes(mapAddr+tileRow, 32)
-
-	lineNum := uint16(yPos % 8)
-	lineNum *= 2
-
-	var data1 [32]byte
-	var data2 [32]byte
+	var row tileRow
 	for i := 0; i < 32; i++ {
 		tileLocation := tileData
-		//tileAddress := mapAddr + tileRow + tileCol
 		tileId := uint16(tileIds[i])
 		if unsigned {
 			tileLocation += tileId * 16
@@ -233,8 +264,25 @@ func (p *ppu) renderBackgroundScanLine() {
 			}
 		}
 
-		data1[i] = p.vram.Read(tileLocation + lineNum)
-		data2[i] = p.vram.Read(tileLocation + lineNum + 1)
+		row.low[i] = p.vram.Read(tileLocation + lineNum)
+		row.high[i] = p.vram.Read(tileLocation + lineNum + 1)
+	}
+	return row
+}
+
+// draws the background and the window right of WX-7, the window is hidden for WX >= 167
+func (p *ppu) renderBackgroundScanLine() {
+	scx, scy := p.getScroll()
+	wx, _ := p.getWindow()
+
+	line := p.getLine()
+	p.triggerWindow()
+	usingWindow := p.windowEnabled() && p.wyTriggered && wx < 167
+
+	background := p.readTileRow(p.getBgTileMapAddr(), scy+line)
+	var window tileRow
+	if usingWindow {
+		window = p.readTileRow(p.getWindowTileMapAddr(), p.windowLine)
 	}
 
 	var colors [4]byte
@@ -242,30 +290,23 @@ func (p *ppu) renderBackgroundScanLine() {
 		colors[i] = p.getBgColor(i)
 	}
 
-	//fmt.Printf("rendering background: line %d -> scx %d scy %d wx %d wy %d tiledata %X tileMap %X bg? %t tileRow %d\n",
-	//	line, scx, scy, wx, wy, tileData, mapAddr, !usingWindow, tileRow)
-	for pixel := byte(0); pixel < 160; pixel++ {
-		pixel := pixel
-		xPos := pixel + scx
-		if usingWindow && pixel >= wx {
-			xPos = pixel - wx
+	enabled := p.backgroundEnabled() // LCDC.0 blanks the background and the window to color 0, sprites still see it
+	for pixel := 0; pixel < 160; pixel++ {
+		var colorNum byte
+		if !enabled {
+			colorNum = 0
+		} else if usingWindow && pixel+7 >= int(wx) {
+			colorNum = window.colorNum(p, byte(pixel+7-int(wx)))
+		} else {
+			colorNum = background.colorNum(p, byte(pixel)+scx)
 		}
-		//tileCol := uint16(xPos) / 8
-
-		data1 := data1[xPos/8]
-		data2 := data2[xPos/8]
-
-		colorBit := 7 - xPos%8
-
-		colorNum := p.getColorNum(data1, data2, colorBit)
 
 		// real color palettes will be done on the front end display
-		colorId := colors[colorNum]
-		bufferAddr := uint(line)*160 + uint(pixel)
-		p.frameBuffer[bufferAddr] = colorId
-
-		//fmt.Printf("pixel %d -> xPos %d tileCol %d tileLocation %X tileAddress %X tileId %d lineNum %d colorBit %d colorNum %d",
-		//	pixel, xPos, tileCol, tileLocation, tileAddress, tileId, lineNum, colorBit, colorNum)
+		p.bgColorNums[pixel] = colorNum
+		p.frameBuffer[int(line)*160+pixel] = colors[colorNum]
+	}
+	if usingWindow {
+		p.windowLine += 1
 	}
 }
 
@@ -276,84 +317,91 @@ func (p *ppu) getColorNum(data1 byte, data2 byte, colorBit byte) byte {
 	return colorNum
 }
 
-func (p *ppu) renderSpritesOnScanLine() { // todo: handle 8x16 sprites
-	use8x16 := p.use8x16Sprites()
-
-	scanLine := p.getLine()
-	ySize := byte(8)
-	if use8x16 {
-		ySize = 16
+// selects the first 10 sprites in OAM order that are on the current line, done at the end of mode 2
+func (p *ppu) scanOAM() {
+	p.spriteCount = 0
+	height := 8
+	if p.use8x16Sprites() {
+		height = 16
 	}
-
-	renderCount := 0
-	for sprite := 39; sprite >= 0 && renderCount <= 10; sprite-- {
-		index := sprite * 4
-		spriteData := p.oam.ReadBytes(memory.OAMStart+uint16(index), 4)
-		yPos := spriteData[0] - 16
-		xPos := spriteData[1] - 8
-		if !(scanLine >= yPos && scanLine < (yPos+ySize)) {
-			continue
+	for i := uint16(0); i < 40 && p.spriteCount < maxSprites; i++ {
+		data := p.oam.ReadBytes(memory.OAMStart+i*4, 4)
+		top := int(data[0]) - 16
+		if top <= p.currentLine && p.currentLine < top+height {
+			copy(p.sprites[p.spriteCount][:], data)
+			p.spriteCount += 1
 		}
-		renderCount += 1
-		line := scanLine - yPos // line of the sprite
+	}
+}
 
-		tileLocation := spriteData[2]
-		if use8x16 {
-			if line > 7 {
-				tileLocation |= 0x01
-			} else {
-				tileLocation &= 0xFE
-			}
-		}
-		attributes := spriteData[3]
+// tile data of the sprite on the current line, Y flip of 8x16 sprites flips over both tiles
+func (p *ppu) spriteRow(sprite [4]byte) (byte, byte, bool) {
+	height := 8
+	if p.use8x16Sprites() {
+		height = 16
+	}
+	row := p.currentLine - (int(sprite[0]) - 16)
+	if row < 0 || row >= height { // OAM changed since the scan
+		return 0, 0, false
+	}
+	tile := sprite[2]
+	if height == 16 {
+		tile &= 0xFE
+	}
+	if go_gb.Bit(sprite[3], 6) {
+		row = height - 1 - row
+	}
+	data := p.vram.ReadBytes(memory.VRAMStart+uint16(tile)*16+uint16(row)*2, 2)
+	return data[0], data[1], true
+}
 
-		var colorAddr uint16
-		if go_gb.Bit(attributes, 4) {
-			colorAddr = go_gb.LCDOBP1
-		} else {
-			colorAddr = go_gb.LCDOBP0
-		}
+// color index of the kth pixel from the left of a sprite row
+func spriteColorNum(p *ppu, low, high, attributes byte, k int) byte {
+	bit := 7 - k
+	if go_gb.Bit(attributes, 5) { // X flip
+		bit = k
+	}
+	return p.getColorNum(low, high, byte(bit))
+}
 
-		xFlip := go_gb.Bit(attributes, 5)
-		yFlip := go_gb.Bit(attributes, 6)
-		// If set to zero then sprite always rendered above bg
-		// If set to 1, sprite is hidden behind the background and window
-		// unless the color of the background or window is white, it's then rendered on top
-		hidden := go_gb.Bit(attributes, 7)
+// draws the sprites selected by the OAM scan, on overlapping pixels the sprite with the smaller X wins and
+// the first one in OAM on equal X, the winner is hidden behind background colors 1-3 when its priority bit is set
+func (p *ppu) renderSpritesOnScanLine() {
+	p.scanOAM()
+	order := make([]int, p.spriteCount)
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return p.sprites[order[i]][1] < p.sprites[order[j]][1]
+	})
 
-		if yFlip {
-			line = ySize - 1 - line
+	var taken [160]bool
+	for _, i := range order {
+		sprite := p.sprites[i]
+		low, high, ok := p.spriteRow(sprite)
+		if !ok {
+			continue
 		}
-
-		line *= 2 // 2 bytes in a line
-
-		dataAddress := (memory.VRAMStart + uint16(tileLocation)*16) + uint16(line)
-		data := p.vram.ReadBytes(dataAddress, 2)
-		low := data[0]
-		high := data[1]
-
-		for tilePixel := 7; tilePixel >= 0; tilePixel-- {
-			pxl := 7 - tilePixel
-			colorBit := tilePixel
-			if xFlip {
-				colorBit = 7 - colorBit
-			}
-
-			pixel := xPos + byte(pxl)
-			if pixel < 0 || pixel >= 160 {
+		attributes := sprite[3]
+		palette := go_gb.LCDOBP0
+		if go_gb.Bit(attributes, 4) {
+			palette = go_gb.LCDOBP1
+		}
+		for k := 0; k < 8; k++ {
+			pixel := int(sprite[1]) - 8 + k
+			if pixel < 0 || pixel >= 160 || taken[pixel] {
 				continue
 			}
-
-			colorNum := p.getColorNum(low, high, byte(colorBit))
-			if colorNum == Transparent {
-				continue // don't update frame buffer
+			colorNum := spriteColorNum(p, low, high, attributes, k)
+			if colorNum == 0 {
+				continue // transparent, a lower priority sprite can still be drawn here
 			}
-
-			col := p.getSpriteColor(colorNum, colorAddr)
-			frameBufferAddr := uint(scanLine)*160 + uint(pixel)
-			if !hidden || p.frameBuffer[frameBufferAddr] == White {
-				p.frameBuffer[frameBufferAddr] = col
+			taken[pixel] = true
+			if go_gb.Bit(attributes, 7) && p.bgColorNums[pixel] != 0 {
+				continue
 			}
+			p.frameBuffer[p.currentLine*160+pixel] = p.getSpriteColor(colorNum, palette)
 		}
 	}
 }
@@ -362,7 +410,49 @@ func (p *ppu) Mode() byte {
 	return p.currentMode
 }
 
+// the frame drawn right after the LCD was turned on is not displayed
+func (p *ppu) drawFrame() {
+	if p.skipFrame {
+		p.skipFrame = false
+		return
+	}
+	p.display.Draw(p.frameBuffer[:])
+}
+
+// turning the LCD off resets LY and the mode, the next frame starts on line 0 when it's turned on again
+func (p *ppu) setLCD(on bool) {
+	p.lcdOn = on
+	p.currentLine = 0
+	p.modeClock = 0
+	p.dot = 0
+	p.resetWindow()
+	p.updateLine()
+	if on {
+		p.skipFrame = true
+		p.setMode(2, 0)
+	} else {
+		p.setMode(0, 0)
+	}
+}
+
 func (p *ppu) Step(mc go_gb.MC) {
+	if on := p.Enabled(); on != p.lcdOn {
+		p.setLCD(on)
+	}
+	if !p.lcdOn {
+		p.updateStatLine()
+		return
+	}
+	if p.useFIFO {
+		p.stepFIFO(mc)
+	} else {
+		p.stepScanline(mc)
+	}
+	p.compareLyLyc() // LYC can be written at any time, not only when LY changes
+	p.updateStatLine()
+}
+
+func (p *ppu) stepScanline(mc go_gb.MC) {
 	p.modeClock += mc
 
 	switch p.currentMode {
@@ -370,7 +460,6 @@ func (p *ppu) Step(mc go_gb.MC) {
 		if p.modeClock >= 20 {
 			p.setMode(3, 20)
 			p.renderScanline()
-			p.handleModeInterrupt(p.io.Read(go_gb.LCDSTAT), 3)
 		}
 	case 3:
 		if p.modeClock >= 43 {
@@ -383,27 +472,51 @@ func (p *ppu) Step(mc go_gb.MC) {
 			if p.currentLine == 144 {
 				p.vblankInterrupt()
 				p.setMode(1, 51)
-				p.display.Draw(p.frameBuffer[:])
+				p.drawFrame()
 			} else {
 				p.setMode(2, 51)
 			}
 		}
-		if p.currentLine == 144 {
-			p.handleModeInterrupt(p.io.Read(go_gb.LCDSTAT), 4)
-		} else {
-			p.handleModeInterrupt(p.io.Read(go_gb.LCDSTAT), 5)
-		}
 	case 1:
 		if p.modeClock >= 114 {
 			p.currentLine += 1
 			if p.currentLine > 153 {
 				p.currentLine = 0
+				p.resetWindow()
 				p.setMode(2, 114)
 			} else {
 				p.modeClock -= 114
 			}
 			p.updateLine()
 		}
-		p.handleModeInterrupt(p.io.Read(go_gb.LCDSTAT), 5)
 	}
 }
+
+// STAT, the mode and coincidence flag are read only, on the DMG a write enables every source for a cycle
+// which requests an interrupt during HBlank, VBlank or LY=LYC
+func (p *ppu) Read(pointer uint16) byte {
+	if pointer != go_gb.LCDSTAT {
+		panic("invalid read from the ppu")
+	}
+	return p.io.Read(go_gb.LCDSTAT) | 0x80
+}
+
+func (p *ppu) ReadBytes(pointer, n uint16) []byte {
+	return go_gb.ReadBytes(p, pointer, n)
+}
+
+func (p *ppu) Store(pointer uint16, val byte) {
+	if pointer != go_gb.LCDSTAT {
+		panic("invalid write to the ppu")
+	}
+	stat := p.io.Read(go_gb.LCDSTAT)
+	if p.gbType == go_gb.GB {
+		p.setStatLine(p.lcdOn && p.statSources(stat|0x58))
+	}
+	p.io.Store(go_gb.LCDSTAT, (val&0x78)|(stat&0x07))
+	p.updateStatLine()
+}
+
+func (p *ppu) StoreBytes(pointer uint16, bytes []byte) {
+	go_gb.WriteBytes(p, pointer, bytes)
+}
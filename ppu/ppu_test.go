@@ -0,0 +1,263 @@
+package ppu
+
+import (
+	go_gb "go-gb"
+	"testing"
+)
+
+// fills tiles 1-3 with their own color, tile 0 stays white
+func storeSolidTiles(m *flatMemory) {
+	for tile := byte(1); tile < 4; tile++ {
+		for row := uint16(0); row < 8; row++ {
+			addr := 0x8000 + uint16(tile)*16 + row*2
+			m.Store(addr, (tile&1)*0xFF)
+			m.Store(addr+1, (tile>>1)*0xFF)
+		}
+	}
+}
+
+// steps a frame, lcdc returns LCDC for every line
+func renderFrame(p *ppu, m *flatMemory, lcdc func(line int) byte) {
+	for p.currentLine < 144 {
+		m.Store(go_gb.LCDControlRegister, lcdc(p.currentLine))
+		p.Step(1)
+	}
+}
+
+func TestPpu_Window(t *testing.T) {
+	tests := []struct {
+		wx       byte
+		expected func(x int) byte
+	}{
+		{7 + 80, func(x int) byte { return go_gb.BitToByte(80 <= x && x < 88) * 3 }},
+		{166, func(x int) byte { return go_gb.BitToByte(x == 159) * 3 }},
+		{167, func(x int) byte { return 0 }},
+		{3, func(x int) byte { return go_gb.BitToByte(x < 4) * 3 }}, // window starts left of the screen
+	}
+	for _, fifo := range []bool{false, true} {
+		for i, test := range tests {
+			p, m := newTestPpu(fifo)
+			storeSolidTiles(m)
+			m.Store(0x9C00, 3) // window tile 0 is black, the rest of the window is white
+			m.Store(go_gb.LCDWX, test.wx)
+			renderFrame(p, m, func(int) byte { return 0xF3 })
+
+			for x := 0; x < 160; x++ {
+				if color := p.frameBuffer[x]; color != test.expected(x) {
+					t.Errorf("FIFO %t test %d pixel %d: expected %X, got %X\n", fifo, i, x, test.expected(x), color)
+					break
+				}
+			}
+			if test.wx >= 167 && p.windowLine != 0 {
+				t.Errorf("FIFO %t test %d: window line shouldn't advance, got %d\n", fifo, i, p.windowLine)
+			}
+		}
+	}
+}
+
+func TestPpu_Window_LineCounter(t *testing.T) {
+	for _, fifo := range []bool{false, true} {
+		p, m := newTestPpu(fifo)
+		storeSolidTiles(m)
+		for row := uint16(0); row < 3; row++ {
+			m.Store(0x9C00+row*32, byte(row+1)) // each window row has its own color
+		}
+		m.Store(go_gb.LCDWX, 7)
+		m.Store(go_gb.LCDWY, 4)
+		renderFrame(p, m, func(line int) byte {
+			if 10 <= line && line < 20 {
+				return 0xD3 // window off
+			}
+			return 0xF3
+		})
+
+		for line, expected := range map[int]byte{0: 0, 4: 1, 9: 1, 10: 0, 19: 0, 20: 1, 22: 2, 29: 2, 30: 3} {
+			if color := p.frameBuffer[line*160]; color != expected {
+				t.Errorf("FIFO %t line %d: expected %X, got %X\n", fifo, line, expected, color)
+			}
+		}
+	}
+}
+
+func TestPpu_Sprites(t *testing.T) {
+	tests := []struct {
+		name     string
+		lcdc     byte
+		bgTile   byte
+		oam      [][4]byte
+		expected map[int]byte // pixels of line 0
+	}{
+		{"ten per line", 0x93, 0, [][4]byte{
+			{16, 8, 3, 0}, {16, 16, 3, 0}, {16, 24, 3, 0}, {16, 32, 3, 0}, {16, 40, 3, 0},
+			{16, 48, 3, 0}, {16, 56, 3, 0}, {16, 64, 3, 0}, {16, 72, 3, 0}, {16, 80, 3, 0},
+			{16, 88, 3, 0},
+		}, map[int]byte{0: 3, 72: 3, 80: 0}},
+		{"smaller X wins", 0x93, 0, [][4]byte{{16, 20, 3, 0}, {16, 16, 3, 0x10}}, map[int]byte{8: 1, 12: 1, 15: 1, 16: 3}},
+		{"OAM order on equal X", 0x93, 0, [][4]byte{{16, 16, 3, 0}, {16, 16, 3, 0x10}}, map[int]byte{8: 3}},
+		{"transparent pixels show the next sprite", 0x93, 0, [][4]byte{{16, 16, 0, 0}, {16, 16, 3, 0x10}}, map[int]byte{8: 1}},
+		{"behind BG colors 1-3", 0x93, 1, [][4]byte{{16, 16, 3, 0x80}}, map[int]byte{8: 0}},
+		{"above BG color 0", 0x93, 0, [][4]byte{{16, 16, 3, 0x80}}, map[int]byte{8: 3}},
+		{"hidden sprite hides lower priority sprites", 0x93, 1, [][4]byte{{16, 16, 3, 0x80}, {16, 16, 3, 0}}, map[int]byte{8: 0}},
+		{"8x16 Y flip", 0x97, 0, [][4]byte{{16, 16, 2, 0x40}}, map[int]byte{8: 3}},
+	}
+	for _, fifo := range []bool{false, true} {
+		for _, test := range tests {
+			p, m := newTestPpu(fifo)
+			storeSolidTiles(m)
+			m.Store(go_gb.LCDBGP, 0x00) // every background color is white
+			m.Store(go_gb.LCDOBP1, 0x54)
+			for i := uint16(0); i < 32; i++ {
+				m.Store(0x9800+i, test.bgTile)
+			}
+			for i, sprite := range test.oam {
+				m.StoreBytes(0xFE00+uint16(i)*4, sprite[:])
+			}
+			renderFrame(p, m, func(int) byte { return test.lcdc })
+
+			for x, expected := range test.expected {
+				if color := p.frameBuffer[x]; color != expected {
+					t.Errorf("FIFO %t %s pixel %d: expected %X, got %X\n", fifo, test.name, x, expected, color)
+				}
+			}
+		}
+	}
+}
+
+type countingDisplay struct {
+	frames int
+}
+
+func (d *countingDisplay) Draw(bufferLine []byte) {
+	d.frames += 1
+}
+
+func (d *countingDisplay) IsDrawing() bool {
+	panic("implement me")
+}
+
+// steps a single machine cycle and reports if a STAT interrupt was requested, IF is cleared afterwards
+func statInterrupt(p *ppu, m *flatMemory) bool {
+	p.Step(1)
+	requested := go_gb.Bit(m.Read(go_gb.IF), int(go_gb.BitLCD))
+	m.Store(go_gb.IF, 0)
+	return requested
+}
+
+func TestPpu_LCDOff(t *testing.T) {
+	for _, fifo := range []bool{false, true} {
+		p, m := newTestPpu(fifo)
+		for p.currentLine < 10 {
+			p.Step(1)
+		}
+		m.Store(go_gb.LCDControlRegister, 0x13)
+		p.Step(1)
+		if ly := m.Read(go_gb.LCDLY); ly != 0 {
+			t.Errorf("fifo %v: expected LY %d, got %d\n", fifo, 0, ly)
+		}
+		if mode := p.Read(go_gb.LCDSTAT) & 0x3; mode != 0 {
+			t.Errorf("fifo %v: expected mode %d, got %d\n", fifo, 0, mode)
+		}
+		for i := 0; i < 1000; i++ {
+			p.Step(1)
+		}
+		if ly := m.Read(go_gb.LCDLY); ly != 0 {
+			t.Errorf("fifo %v: expected LY to stay %d, got %d\n", fifo, 0, ly)
+		}
+
+		m.Store(go_gb.LCDControlRegister, 0x93)
+		p.Step(1)
+		if mode := p.Read(go_gb.LCDSTAT) & 0x3; p.currentLine != 0 || mode != 2 {
+			t.Errorf("fifo %v: expected line 0 in mode 2, got line %d in mode %d\n", fifo, p.currentLine, mode)
+		}
+	}
+}
+
+func TestPpu_FirstFrameAfterEnable(t *testing.T) {
+	for _, fifo := range []bool{false, true} {
+		p, m := newTestPpu(fifo)
+		display := &countingDisplay{}
+		p.display = display
+		for i := 1; i <= 3; i++ {
+			renderFrame(p, m, func(int) byte { return 0x93 })
+			for p.currentLine != 0 {
+				p.Step(1)
+			}
+			if display.frames != i-1 {
+				t.Errorf("fifo %v: expected %d frames, got %d\n", fifo, i-1, display.frames)
+			}
+		}
+	}
+}
+
+func TestPpu_StatBlocking(t *testing.T) {
+	for _, fifo := range []bool{false, true} {
+		p, m := newTestPpu(fifo)
+		m.Store(go_gb.LCDLYC, 1)
+		m.Store(go_gb.LCDSTAT, 0x48) // HBlank and LY=LYC
+		p.Step(1)
+		m.Store(go_gb.IF, 0)
+
+		lines := map[int]int{}
+		for p.currentLine < 3 {
+			if statInterrupt(p, m) {
+				lines[p.currentLine] += 1
+			}
+		}
+		// the HBlank of line 0 keeps the line high into LY=LYC on line 1, which blocks the HBlank of line 1
+		if lines[0] != 1 || lines[1] != 0 || lines[2] != 1 {
+			t.Errorf("fifo %v: expected interrupts on lines 0 and 2, got %v\n", fifo, lines)
+		}
+	}
+}
+
+func TestPpu_LYCWrite(t *testing.T) {
+	for _, fifo := range []bool{false, true} {
+		p, m := newTestPpu(fifo)
+		m.Store(go_gb.LCDLYC, 100)
+		m.Store(go_gb.LCDSTAT, 0x40) // LY=LYC
+		for p.currentLine != 5 || p.currentMode != 3 {
+			p.Step(1)
+		}
+		m.Store(go_gb.IF, 0)
+
+		m.Store(go_gb.LCDLYC, 5)
+		if !statInterrupt(p, m) {
+			t.Errorf("fifo %v: expected an interrupt when LYC is set to the current line\n", fifo)
+		}
+		if stat := p.Read(go_gb.LCDSTAT); !go_gb.Bit(stat, go_gb.LCDSTATCoincidenceFlag) {
+			t.Errorf("fifo %v: expected the coincidence flag, got %X\n", fifo, stat)
+		}
+	}
+}
+
+func TestPpu_StatWriteQuirk(t *testing.T) {
+	tests := []struct {
+		gbType    go_gb.GameboyType
+		mode      byte
+		requested bool
+	}{
+		{go_gb.GB, 2, false},
+		{go_gb.GB, 3, false},
+		{go_gb.GB, 0, true},
+		{go_gb.GB, 1, true},
+		{go_gb.CGB, 0, false},
+		{go_gb.CGB, 1, false},
+	}
+	for _, test := range tests {
+		p, m := newTestPpu(false)
+		p.gbType = test.gbType
+		m.Store(go_gb.LCDLYC, 100)
+		p.Step(1)
+		for p.currentMode != test.mode {
+			p.Step(1)
+		}
+		m.Store(go_gb.IF, 0)
+		p.Store(go_gb.LCDSTAT, 0)
+		if requested := go_gb.Bit(m.Read(go_gb.IF), int(go_gb.BitLCD)); requested != test.requested {
+			t.Errorf("type %d, mode %d: expected %v, got %v\n", test.gbType, test.mode, test.requested, requested)
+		}
+		if stat := p.Read(go_gb.LCDSTAT); stat != 0x80|test.mode {
+			t.Errorf("mode %d: expected %X, got %X\n", test.mode, 0x80|test.mode, stat)
+		}
+	}
+}
@@ -0,0 +1,218 @@
+package rewind
+
+import (
+	"bytes"
+	"compress/flate"
+	"errors"
+	go_gb "go-gb"
+	"io/ioutil"
+	"sync"
+)
+
+var ErrEmpty = errors.New("nothing to rewind")
+
+type Config struct {
+	Interval int // frames between two snapshots
+	MaxBytes int // memory used by the snapshots including the newest uncompressed one, the oldest ones are dropped above it
+}
+
+// default config keeping a snapshot every 4 frames in 8 MiB
+var DefaultConfig = Config{Interval: 4, MaxBytes: 8 << 20}
+
+// snapshot stored as the XOR against the snapshot taken after it
+type delta struct {
+	data  []byte // flate compressed
+	size  int    // size of the older snapshot
+	frame uint64
+}
+
+// ring buffer of machine snapshots, only the newest one is kept in full
+type buffer struct {
+	state  go_gb.Stateful
+	config Config
+
+	frame       uint64 // frames since the buffer was created, moves back on rewind
+	latest      []byte
+	latestFrame uint64
+
+	deltas []delta // ring buffer, start is the oldest delta
+	start  int
+	count  int
+	bytes  int
+
+	scratch bytes.Buffer
+	writer  *flate.Writer
+	mutex   sync.Mutex
+}
+
+func NewBuffer(state go_gb.Stateful, config Config) *buffer {
+	if config.Interval < 1 {
+		config.Interval = 1
+	}
+	writer, _ := flate.NewWriter(nil, flate.BestSpeed)
+	return &buffer{state: state, config: config, writer: writer}
+}
+
+// called once per emulated frame, takes a snapshot every config.Interval frames
+func (b *buffer) Frame() error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.frame += 1
+	if b.latest != nil && b.frame-b.latestFrame < uint64(b.config.Interval) {
+		return nil
+	}
+	return b.capture()
+}
+
+func (b *buffer) capture() error {
+	b.scratch.Reset()
+	if err := b.state.SaveState(&b.scratch); err != nil {
+		return err
+	}
+	snapshot := append([]byte(nil), b.scratch.Bytes()...)
+	previous, previousFrame := b.latest, b.latestFrame
+	var data []byte
+	if previous != nil {
+		var err error
+		if data, err = b.compress(xor(previous, snapshot)); err != nil {
+			return err
+		}
+	}
+	b.latest = snapshot
+	b.latestFrame = b.frame
+	if previous != nil {
+		b.push(delta{data: data, size: len(previous), frame: previousFrame})
+	}
+	return nil
+}
+
+// returns a XOR b, the shorter slice is padded with zeroes
+func xor(a, b []byte) []byte {
+	if len(a) < len(b) {
+		a, b = b, a
+	}
+	result := append([]byte(nil), a...)
+	for i, val := range b {
+		result[i] ^= val
+	}
+	return result
+}
+
+func (b *buffer) compress(data []byte) ([]byte, error) {
+	var out bytes.Buffer
+	b.writer.Reset(&out)
+	if _, err := b.writer.Write(data); err != nil {
+		return nil, err
+	}
+	if err := b.writer.Close(); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+func decompress(data []byte) ([]byte, error) {
+	reader := flate.NewReader(bytes.NewReader(data))
+	defer reader.Close()
+	return ioutil.ReadAll(reader)
+}
+
+// stores the delta to the newest snapshot, which has to be set already as it counts against the limit
+func (b *buffer) push(d delta) {
+	if len(b.latest)+len(d.data) > b.config.MaxBytes {
+		b.clear() // older snapshots can't be reached without this delta
+		return
+	}
+	for b.count > 0 && len(b.latest)+b.bytes+len(d.data) > b.config.MaxBytes {
+		b.dropOldest()
+	}
+	if b.count == len(b.deltas) {
+		b.grow()
+	}
+	b.deltas[(b.start+b.count)%len(b.deltas)] = d
+	b.count += 1
+	b.bytes += len(d.data)
+}
+
+func (b *buffer) grow() {
+	size := len(b.deltas) * 2
+	if size == 0 {
+		size = 64
+	}
+	deltas := make([]delta, size)
+	for i := 0; i < b.count; i++ {
+		deltas[i] = b.deltas[(b.start+i)%len(b.deltas)]
+	}
+	b.deltas = deltas
+	b.start = 0
+}
+
+func (b *buffer) dropOldest() {
+	b.bytes -= len(b.deltas[b.start].data)
+	b.deltas[b.start] = delta{}
+	b.start = (b.start + 1) % len(b.deltas)
+	b.count -= 1
+}
+
+func (b *buffer) popNewest() delta {
+	i := (b.start + b.count - 1) % len(b.deltas)
+	d := b.deltas[i]
+	b.deltas[i] = delta{}
+	b.count -= 1
+	b.bytes -= len(d.data)
+	return d
+}
+
+func (b *buffer) clear() {
+	for b.count > 0 {
+		b.dropOldest()
+	}
+}
+
+// loads the newest snapshot that is at least the given number of frames old,
+// or the oldest one if the buffer doesn't reach that far back
+func (b *buffer) Rewind(frames int) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if b.latest == nil {
+		return ErrEmpty
+	}
+	var target uint64
+	if uint64(frames) < b.frame {
+		target = b.frame - uint64(frames)
+	}
+	for b.latestFrame > target && b.count > 0 {
+		d := b.popNewest()
+		data, err := decompress(d.data)
+		if err != nil {
+			return err
+		}
+		b.latest = xor(b.latest, data)[:d.size]
+		b.latestFrame = d.frame
+	}
+	if err := b.state.LoadState(bytes.NewReader(b.latest)); err != nil {
+		return err
+	}
+	b.frame = b.latestFrame
+	return nil
+}
+
+// returns the number of frames that can be rewound
+func (b *buffer) Frames() int {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if b.latest == nil {
+		return 0
+	}
+	oldest := b.latestFrame
+	if b.count > 0 {
+		oldest = b.deltas[b.start].frame
+	}
+	return int(b.frame - oldest)
+}
+
+// returns the memory used by the stored snapshots
+func (b *buffer) Size() int {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.bytes + len(b.latest)
+}
@@ -0,0 +1,96 @@
+package rewind
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+// mock machine whose state is the number of the frame it is in
+type mockState struct {
+	frame  byte
+	memory [1024]byte
+}
+
+func (m *mockState) step() {
+	m.frame += 1
+	m.memory[m.frame] = m.frame
+}
+
+func (m *mockState) SaveState(w io.Writer) error {
+	_, err := w.Write(append([]byte{m.frame}, m.memory[:]...))
+	return err
+}
+
+func (m *mockState) LoadState(r io.Reader) error {
+	var buf bytes.Buffer
+	if _, err := buf.ReadFrom(r); err != nil {
+		return err
+	}
+	m.frame = buf.Bytes()[0]
+	copy(m.memory[:], buf.Bytes()[1:])
+	return nil
+}
+
+func run(state *mockState, b *buffer, frames int) {
+	for i := 0; i < frames; i++ {
+		state.step()
+		if err := b.Frame(); err != nil {
+			panic(err)
+		}
+	}
+}
+
+func TestBuffer_Rewind(t *testing.T) {
+	state := &mockState{}
+	b := NewBuffer(state, Config{Interval: 2, MaxBytes: 1 << 20})
+	if err := b.Rewind(1); err != ErrEmpty {
+		t.Errorf("expected %v, got %v\n", ErrEmpty, err)
+	}
+	run(state, b, 21)
+
+	if err := b.Rewind(6); err != nil {
+		t.Fatal(err)
+	}
+	if state.frame != 15 {
+		t.Errorf("expected frame %d, got %d\n", 15, state.frame)
+	}
+	if state.memory[16] != 0 || state.memory[15] != 15 {
+		t.Errorf("expected the memory of frame %d, got %v\n", 15, state.memory[14:18])
+	}
+
+	run(state, b, 4)
+	if err := b.Rewind(3); err != nil {
+		t.Fatal(err)
+	}
+	if state.frame != 15 {
+		t.Errorf("expected frame %d, got %d\n", 15, state.frame)
+	}
+	if err := b.Rewind(100); err != nil {
+		t.Fatal(err)
+	}
+	if state.frame != 1 {
+		t.Errorf("expected the oldest frame %d, got %d\n", 1, state.frame)
+	}
+}
+
+func TestBuffer_MaxBytes(t *testing.T) {
+	state := &mockState{}
+	maxBytes := len(state.memory) + 1 + 200 // the newest snapshot and a few deltas
+	b := NewBuffer(state, Config{Interval: 1, MaxBytes: maxBytes})
+	run(state, b, 100)
+
+	if size := b.Size(); size > maxBytes {
+		t.Errorf("expected at most %d bytes, got %d\n", maxBytes, size)
+	}
+	frames := b.Frames()
+	if frames == 0 || frames >= 99 {
+		t.Errorf("expected the oldest snapshots to be dropped, can rewind %d frames\n", frames)
+	}
+	if err := b.Rewind(1000); err != nil {
+		t.Fatal(err)
+	}
+	if expected := byte(100 - frames); state.frame != expected {
+		t.Errorf("expected frame %d, got %d\n", expected, state.frame)
+	}
+}
@@ -13,6 +13,17 @@ type Controller interface {
 	Wait() bool
 }
 
+// notified after every frame
+type FrameListener interface {
+	Frame() error
+}
+
+// keeps snapshots of the machine so it can be rewound
+type Rewinder interface {
+	FrameListener
+	Rewind(frames int) error
+}
+
 type scheduler struct {
 	cpu go_gb.Cpu
 	ppu go_gb.PPU
@@ -22,12 +33,47 @@ type scheduler struct {
 	Throttle  bool
 
 	Controller Controller
+	Rewinder   Rewinder
+	Listeners  []FrameListener // e.g. movie recording and playback, called before the rewinder
+
+	rewinds chan int
+	stopped int32
 }
 
 func NewScheduler(cpu go_gb.Cpu, ppu go_gb.PPU, lcd go_gb.Display) *scheduler {
 	const PpuFrequency = 59.7
 	ppuFreq := time.Duration(math.Round(float64(time.Second.Nanoseconds()) / PpuFrequency))
-	return &scheduler{cpu: cpu, ppu: ppu, lcd: lcd, Frequency: ppuFreq, Throttle: true}
+	return &scheduler{cpu: cpu, ppu: ppu, lcd: lcd, Frequency: ppuFreq, Throttle: true, rewinds: make(chan int, 1)}
+}
+
+// rewinds the machine by the given number of frames, the rewind happens at the end of the current frame
+func (s *scheduler) Rewind(frames int) {
+	select {
+	case s.rewinds <- frames:
+	default: // a rewind is already pending
+	}
+}
+
+// makes Run return after the current instruction, it can be called from any goroutine
+func (s *scheduler) Stop() {
+	atomic.StoreInt32(&s.stopped, 1)
+}
+
+func (s *scheduler) rewind() {
+	if s.Rewinder == nil {
+		return
+	}
+	select {
+	case frames := <-s.rewinds:
+		if err := s.Rewinder.Rewind(frames); err != nil {
+			fmt.Println("failed rewinding", err)
+		}
+		return
+	default:
+	}
+	if err := s.Rewinder.Frame(); err != nil {
+		fmt.Println("failed taking a rewind snapshot", err)
+	}
 }
 
 func (s *scheduler) Run() {
@@ -61,7 +107,7 @@ func (s *scheduler) Run() {
 		}
 	}()
 
-	for {
+	for atomic.LoadInt32(&s.stopped) == 0 {
 		if s.Controller != nil && s.Controller.Wait() {
 			start = time.Now()
 		} // optionally wait (e.g. user debugging)
@@ -74,6 +120,12 @@ func (s *scheduler) Run() {
 			}
 			continue
 		}
+		for _, listener := range s.Listeners {
+			if err := listener.Frame(); err != nil {
+				fmt.Println("frame listener failed", err)
+			}
+		}
+		s.rewind()
 		if s.Throttle {
 			start = start.Add(s.Frequency)
 			time.Sleep(time.Until(start))
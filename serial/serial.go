@@ -45,6 +45,29 @@ func NewSerial(in ExternalSerial, inWriter, outWriter io.ReadWriter, memory go_g
 	return &serial{in: in, inWriter: inWriter, outWriter: outWriter, memory: memory}
 }
 
+// saves the shift state, the external connection is not part of the state
+func (s *serial) SaveState(w io.Writer) error {
+	hasInByte := s.inByte != nil
+	var inByte byte
+	if hasInByte {
+		inByte = *s.inByte
+	}
+	return go_gb.WriteState(w, &hasInByte, &inByte, &s.outByte, &s.counter, &s.cycles, &s.readyForSending)
+}
+
+func (s *serial) LoadState(r io.Reader) error {
+	var hasInByte bool
+	var inByte byte
+	if err := go_gb.ReadState(r, &hasInByte, &inByte, &s.outByte, &s.counter, &s.cycles, &s.readyForSending); err != nil {
+		return err
+	}
+	s.inByte = nil
+	if hasInByte {
+		s.inByte = &inByte
+	}
+	return nil
+}
+
 func (s *serial) Stream() io.Reader {
 	return s.inWriter
 }
@@ -1 +1,34 @@
 package go_gb
+
+const (
+	NR10 uint16 = 0xFF10 // Channel 1 Sweep register (R/W)
+	NR11 uint16 = 0xFF11 // Channel 1 Sound length/Wave pattern duty (R/W)
+	NR12 uint16 = 0xFF12 // Channel 1 Volume Envelope (R/W)
+	NR13 uint16 = 0xFF13 // Channel 1 Frequency lo (W)
+	NR14 uint16 = 0xFF14 // Channel 1 Frequency hi (R/W)
+
+	NR21 uint16 = 0xFF16 // Channel 2 Sound Length/Wave Pattern Duty (R/W)
+	NR22 uint16 = 0xFF17 // Channel 2 Volume Envelope (R/W)
+	NR23 uint16 = 0xFF18 // Channel 2 Frequency lo data (W)
+	NR24 uint16 = 0xFF19 // Channel 2 Frequency hi data (R/W)
+
+	NR30 uint16 = 0xFF1A // Channel 3 Sound on/off (R/W)
+	NR31 uint16 = 0xFF1B // Channel 3 Sound Length (W)
+	NR32 uint16 = 0xFF1C // Channel 3 Select output level (R/W)
+	NR33 uint16 = 0xFF1D // Channel 3 Frequency's lower data (W)
+	NR34 uint16 = 0xFF1E // Channel 3 Frequency's higher data (R/W)
+
+	NR41 uint16 = 0xFF20 // Channel 4 Sound Length (W)
+	NR42 uint16 = 0xFF21 // Channel 4 Volume Envelope (R/W)
+	NR43 uint16 = 0xFF22 // Channel 4 Polynomial Counter (R/W)
+	NR44 uint16 = 0xFF23 // Channel 4 Counter/consecutive; Initial (R/W)
+
+	NR50 uint16 = 0xFF24 // Channel control / ON-OFF / Volume (R/W)
+	NR51 uint16 = 0xFF25 // Selection of Sound output terminal (R/W)
+	NR52 uint16 = 0xFF26 // Sound on/off
+
+	SoundStart   uint16 = NR10
+	WaveRAMStart uint16 = 0xFF30 // Wave Pattern RAM, 32 4-bit samples
+	WaveRAMEnd   uint16 = 0xFF3F
+	SoundEnd     uint16 = WaveRAMEnd
+)
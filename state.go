@@ -0,0 +1,78 @@
+package go_gb
+
+import (
+	"encoding/binary"
+	"io"
+)
+
+// component whose internal state can be saved and restored
+type Stateful interface {
+	SaveState(w io.Writer) error
+	LoadState(r io.Reader) error
+}
+
+// writes the values in order, values must be pointers to fixed-size values, ints or machine cycles
+func WriteState(w io.Writer, values ...interface{}) error {
+	for _, value := range values {
+		switch v := value.(type) {
+		case *int:
+			value = int64(*v)
+		case *uint:
+			value = uint64(*v)
+		case *MC:
+			value = uint64(*v)
+		}
+		if err := binary.Write(w, binary.LittleEndian, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// reads the values written by WriteState in the same order
+func ReadState(r io.Reader, values ...interface{}) error {
+	for _, value := range values {
+		var err error
+		switch v := value.(type) {
+		case *int:
+			var val int64
+			err = binary.Read(r, binary.LittleEndian, &val)
+			*v = int(val)
+		case *uint:
+			var val uint64
+			err = binary.Read(r, binary.LittleEndian, &val)
+			*v = uint(val)
+		case *MC:
+			var val uint64
+			err = binary.Read(r, binary.LittleEndian, &val)
+			*v = MC(val)
+		default:
+			err = binary.Read(r, binary.LittleEndian, value)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// components saved and restored one after the other, e.g. the components of a machine wired by hand
+type StatefulGroup []Stateful
+
+func (g StatefulGroup) SaveState(w io.Writer) error {
+	for _, component := range g {
+		if err := component.SaveState(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (g StatefulGroup) LoadState(r io.Reader) error {
+	for _, component := range g {
+		if err := component.LoadState(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -6,3 +6,8 @@ const (
 	TMA  uint16 = 0xFF06 // Timer modulo (R/W)
 	TAC  uint16 = 0xFF07 // Timer control (R/W)
 )
+
+const (
+	TimerStart = DIV
+	TimerEnd   = TAC
+)
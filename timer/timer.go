@@ -1,57 +1,146 @@
 package timer
 
-import go_gb "go-gb"
+import (
+	go_gb "go-gb"
+	"io"
+)
 
+// counter bit whose falling edge increments TIMA for each TAC clock select
+var clockBits = [...]uint16{1 << 9, 1 << 3, 1 << 5, 1 << 7}
+
+// timer driven by the 16-bit system counter, DIV is its upper byte and TIMA increments on the falling edge
+// of the counter bit selected by TAC, the registers are mirrored into IO for components reading them directly
 type timer struct {
-	io            go_gb.Memory
-	enabled       bool
-	frequency     go_gb.MC
-	currentCycles go_gb.MC
+	io go_gb.Memory
+
+	counter  uint16 // system counter, incremented every T cycle
+	tima     byte
+	tma      byte
+	tac      byte
+	overflow bool // TIMA overflowed in the last cycle and reads 0, TMA is loaded in the next one
+	reloaded bool // TMA was loaded in this cycle, TIMA writes are ignored and TMA writes go through to TIMA
 }
 
 func NewTimer(io go_gb.Memory) *timer {
 	return &timer{io: io}
 }
 
-func mapFrequency(clockSelect byte) go_gb.MC {
-	switch clockSelect & 0x3 {
-	case 0b00:
-		return 4096 / 4
-	case 0b01:
-		return 262144 / 4
-	case 0b10:
-		return 65536 / 4
-	case 0b11:
-		return 16384 / 4
+func (t *timer) SaveState(w io.Writer) error {
+	return go_gb.WriteState(w, &t.counter, &t.tima, &t.tma, &t.tac, &t.overflow, &t.reloaded)
+}
+
+func (t *timer) LoadState(r io.Reader) error {
+	if err := go_gb.ReadState(r, &t.counter, &t.tima, &t.tma, &t.tac, &t.overflow, &t.reloaded); err != nil {
+		return err
 	}
-	panic("invalid frequency")
+	t.mirror()
+	return nil
 }
 
-func (t *timer) loadConfig() {
-	timerControl := t.io.Read(go_gb.TAC)
-	t.enabled = go_gb.Bit(timerControl, 2)
-	t.frequency = mapFrequency(timerControl)
+// loads the registers from IO, e.g. after they were restored by a save state of another emulator
+func (t *timer) LoadRegisters() {
+	t.counter = uint16(t.io.Read(go_gb.DIV)) << 8
+	t.tima = t.io.Read(go_gb.TIMA)
+	t.tma = t.io.Read(go_gb.TMA)
+	t.tac = t.io.Read(go_gb.TAC) & 0x07
+	t.overflow = false
+	t.reloaded = false
+	t.mirror()
 }
 
 func (t *timer) Step(cycles go_gb.MC) {
-	t.loadConfig()
-	if !t.enabled {
-		return
+	for i := go_gb.MC(0); i < cycles; i++ {
+		t.reloaded = false
+		if t.overflow {
+			t.overflow = false
+			t.reloaded = true
+			t.tima = t.tma
+			go_gb.Update(t.io, go_gb.IF, func(b byte) byte {
+				go_gb.Set(&b, int(go_gb.BitTimer), true)
+				return b
+			})
+		}
+		t.setCounter(t.counter + 4)
+	}
+	t.mirror()
+}
+
+// input of the TIMA falling edge detector
+func (t *timer) signal() bool {
+	return go_gb.Bit(t.tac, 2) && t.counter&clockBits[t.tac&0x03] != 0
+}
+
+func (t *timer) setCounter(counter uint16) {
+	before := t.signal()
+	t.counter = counter
+	if before && !t.signal() {
+		t.increment()
+	}
+}
+
+func (t *timer) setControl(tac byte) {
+	before := t.signal()
+	t.tac = tac & 0x07
+	if before && !t.signal() { // disabling the timer or selecting a low bit is a falling edge as well
+		t.increment()
+	}
+}
+
+func (t *timer) increment() {
+	t.tima += 1
+	if t.tima == 0 {
+		t.overflow = true
 	}
-	t.currentCycles += cycles
-
-	if t.currentCycles >= t.frequency {
-		go_gb.Update(t.io, go_gb.TIMA, func(b byte) byte {
-			b += 1
-			if b == 0 {
-				go_gb.Update(t.io, go_gb.IF, func(b byte) byte {
-					go_gb.Set(&b, int(go_gb.BitTimer), true)
-					return b
-				})
-				return t.io.Read(go_gb.TMA)
-			}
-			return b
-		})
-		t.currentCycles -= t.frequency
+}
+
+func (t *timer) mirror() {
+	t.io.Store(go_gb.DIV, t.Read(go_gb.DIV))
+	t.io.Store(go_gb.TIMA, t.tima)
+	t.io.Store(go_gb.TMA, t.tma)
+	t.io.Store(go_gb.TAC, t.Read(go_gb.TAC))
+}
+
+func (t *timer) Read(pointer uint16) byte {
+	switch pointer {
+	case go_gb.DIV:
+		return byte(t.counter >> 8)
+	case go_gb.TIMA:
+		return t.tima
+	case go_gb.TMA:
+		return t.tma
+	case go_gb.TAC:
+		return t.tac | 0xF8
 	}
+	panic("invalid read from the timer")
+}
+
+func (t *timer) ReadBytes(pointer, n uint16) []byte {
+	return go_gb.ReadBytes(t, pointer, n)
+}
+
+func (t *timer) Store(pointer uint16, val byte) {
+	switch pointer {
+	case go_gb.DIV: // any write resets the whole counter
+		t.setCounter(0)
+	case go_gb.TIMA:
+		if t.reloaded {
+			return
+		}
+		t.overflow = false // writing in the cycle after the overflow cancels the reload and the interrupt
+		t.tima = val
+	case go_gb.TMA:
+		t.tma = val
+		if t.reloaded {
+			t.tima = val
+		}
+	case go_gb.TAC:
+		t.setControl(val)
+	default:
+		panic("invalid write to the timer")
+	}
+	t.mirror()
+}
+
+func (t *timer) StoreBytes(pointer uint16, bytes []byte) {
+	go_gb.WriteBytes(t, pointer, bytes)
 }
@@ -0,0 +1,130 @@
+package timer
+
+import (
+	go_gb "go-gb"
+	"testing"
+)
+
+type mockIO struct {
+	registers [0x80]byte
+}
+
+func (m *mockIO) ReadBytes(pointer, n uint16) []byte {
+	panic("implement me")
+}
+
+func (m *mockIO) Read(pointer uint16) byte {
+	return m.registers[pointer-0xFF00]
+}
+
+func (m *mockIO) StoreBytes(pointer uint16, bytes []byte) {
+	panic("implement me")
+}
+
+func (m *mockIO) Store(pointer uint16, val byte) {
+	m.registers[pointer-0xFF00] = val
+}
+
+func newEnabled(tac byte) (*timer, *mockIO) {
+	io := &mockIO{}
+	t := NewTimer(io)
+	t.Store(go_gb.TAC, tac)
+	return t, io
+}
+
+func TestTimer_DIV(t *testing.T) {
+	timer, io := newEnabled(0)
+	timer.Step(64)
+	if div := timer.Read(go_gb.DIV); div != 1 {
+		t.Errorf("expected %X, got %X\n", 1, div)
+	}
+	if div := io.Read(go_gb.DIV); div != 1 {
+		t.Errorf("expected DIV mirrored into IO, got %X\n", div)
+	}
+	timer.Store(go_gb.DIV, 0xAB)
+	if div := timer.Read(go_gb.DIV); div != 0 {
+		t.Errorf("expected %X, got %X\n", 0, div)
+	}
+}
+
+func TestTimer_Frequency(t *testing.T) {
+	for tac, cycles := range map[byte]go_gb.MC{0x04: 256, 0x05: 4, 0x06: 16, 0x07: 64} {
+		timer, _ := newEnabled(tac)
+		timer.Step(cycles - 1)
+		if tima := timer.Read(go_gb.TIMA); tima != 0 {
+			t.Errorf("TAC %X: expected %X, got %X\n", tac, 0, tima)
+		}
+		timer.Step(1)
+		if tima := timer.Read(go_gb.TIMA); tima != 1 {
+			t.Errorf("TAC %X: expected %X, got %X\n", tac, 1, tima)
+		}
+	}
+}
+
+func TestTimer_Overflow(t *testing.T) {
+	timer, io := newEnabled(0x05)
+	timer.Store(go_gb.TMA, 0x42)
+	timer.Store(go_gb.TIMA, 0xFF)
+
+	timer.Step(4)
+	if tima := timer.Read(go_gb.TIMA); tima != 0 {
+		t.Errorf("expected TIMA to read %X for a cycle, got %X\n", 0, tima)
+	}
+	if io.Read(go_gb.IF) != 0 {
+		t.Error("interrupt should be delayed by a cycle")
+	}
+	timer.Step(1)
+	if tima := timer.Read(go_gb.TIMA); tima != 0x42 {
+		t.Errorf("expected %X, got %X\n", 0x42, tima)
+	}
+	if !go_gb.Bit(io.Read(go_gb.IF), int(go_gb.BitTimer)) {
+		t.Error("expected the timer interrupt")
+	}
+}
+
+func TestTimer_Overflow_Writes(t *testing.T) {
+	tests := []struct {
+		delay        go_gb.MC // cycles after the overflow
+		register     uint16
+		expectedTima byte
+		interrupt    bool
+	}{
+		{0, go_gb.TIMA, 0x10, false}, // TIMA write before the reload cancels it
+		{1, go_gb.TIMA, 0x42, true},  // TIMA write in the reload cycle is ignored
+		{1, go_gb.TMA, 0x10, true},   // TMA write in the reload cycle goes through to TIMA
+		{0, go_gb.TMA, 0x10, true},   // TMA write before the reload is loaded
+	}
+	for i, test := range tests {
+		timer, io := newEnabled(0x05)
+		timer.Store(go_gb.TMA, 0x42)
+		timer.Store(go_gb.TIMA, 0xFF)
+		timer.Step(4 + test.delay)
+		timer.Store(test.register, 0x10)
+		timer.Step(2 - test.delay)
+
+		if tima := timer.Read(go_gb.TIMA); tima != test.expectedTima {
+			t.Errorf("test %d expected %X, got %X\n", i, test.expectedTima, tima)
+		}
+		if interrupt := go_gb.Bit(io.Read(go_gb.IF), int(go_gb.BitTimer)); interrupt != test.interrupt {
+			t.Errorf("test %d expected interrupt %t\n", i, test.interrupt)
+		}
+	}
+}
+
+func TestTimer_Glitches(t *testing.T) {
+	timer, _ := newEnabled(0x05)
+	timer.Step(2) // bit 3 is set
+	timer.Store(go_gb.DIV, 0)
+	if tima := timer.Read(go_gb.TIMA); tima != 1 {
+		t.Errorf("DIV write: expected %X, got %X\n", 1, tima)
+	}
+
+	timer.Step(2)
+	timer.Store(go_gb.TAC, 0x01) // disabling the timer with the selected bit set
+	if tima := timer.Read(go_gb.TIMA); tima != 2 {
+		t.Errorf("TAC write: expected %X, got %X\n", 2, tima)
+	}
+	if tac := timer.Read(go_gb.TAC); tac != 0xF9 {
+		t.Errorf("expected %X, got %X\n", 0xF9, tac)
+	}
+}
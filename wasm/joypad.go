@@ -3,6 +3,7 @@ package wasm
 import (
 	"fmt"
 	go_gb "go-gb"
+	joypad2 "go-gb/joypad"
 	"sync"
 	"syscall/js"
 )
@@ -31,15 +32,23 @@ type Joypad interface {
 	Subscribe(executor func(pressed bool), keys ...Key)
 }
 
+type core interface {
+	go_gb.IOJoypad
+	Press(buttons go_gb.Button)
+	Release(buttons go_gb.Button)
+	Buttons() go_gb.Button
+}
+
+// forwards the browser key events to the core joypad
 type joypad struct {
-	io            go_gb.Memory
+	core          core
 	currentlyHeld map[Key]bool
 	subscriptions map[Key][]func(pressed bool)
 	mutex         sync.Mutex
 }
 
 func NewJoypad() *joypad {
-	j := &joypad{currentlyHeld: make(map[Key]bool), subscriptions: make(map[Key][]func(bool))}
+	j := &joypad{core: joypad2.NewJoypad(), currentlyHeld: make(map[Key]bool), subscriptions: make(map[Key][]func(bool))}
 	js.Global().Set("keyDown", js.FuncOf(func(this js.Value, args []js.Value) interface{} {
 		key := Key(args[0].Int())
 		j.KeyDown(key)
@@ -58,12 +67,18 @@ func NewJoypad() *joypad {
 }
 
 func (j *joypad) Init(io go_gb.Memory) {
-	j.io = io
+	j.core.Init(io)
 }
 
 func (j *joypad) IsPressed(key Key) bool {
-	isPressed, exists := j.currentlyHeld[key]
-	return isPressed && exists
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	return j.currentlyHeld[key]
+}
+
+// returns the currently held buttons, used for recording movies
+func (j *joypad) Buttons() go_gb.Button {
+	return j.core.Buttons()
 }
 
 func (j *joypad) Subscribe(executor func(bool), keys ...Key) {
@@ -81,6 +96,9 @@ func (j *joypad) KeyDown(key Key) {
 
 	fmt.Println("JOYP key down", key)
 	j.currentlyHeld[key] = true
+	if key <= Start {
+		j.core.Press(1 << key)
+	}
 	j.handleSubs(key, true)
 	go_gb.Events.Add("keydown")
 }
@@ -91,6 +109,9 @@ func (j *joypad) KeyUp(key Key) {
 
 	fmt.Println("JOYP key up", key)
 	j.currentlyHeld[key] = false
+	if key <= Start {
+		j.core.Release(1 << key)
+	}
 	j.handleSubs(key, false)
 	go_gb.Events.Add("keyup")
 }
@@ -103,26 +124,9 @@ func (j *joypad) handleSubs(key Key, val bool) {
 }
 
 func (j *joypad) Read(pointer uint16) byte {
-	if pointer != go_gb.JOYP {
-		panic("invalid read from JOYP")
-	}
-	buttons := j.io.Read(go_gb.JOYP)&0x20 != 0
-	if buttons {
-		result := byte(0x20)
-		for i := 0; i < 4; i++ {
-			currentlyHeld, pressedBefore := j.currentlyHeld[Key(i)]
-			if !pressedBefore || !currentlyHeld {
-				result |= 1 << i
-			}
-		}
-		return result
-	}
-	result := byte(0x10)
-	for i := 0; i < 4; i++ {
-		currentlyHeld, pressedBefore := j.currentlyHeld[Key(i+4)]
-		if !pressedBefore || !currentlyHeld {
-			result |= 1 << i
-		}
-	}
-	return result
+	return j.core.Read(pointer)
+}
+
+func (j *joypad) Step(mc go_gb.MC) {
+	j.core.Step(mc)
 }
@@ -0,0 +1,18 @@
+package wasm
+
+import (
+	"syscall/js"
+)
+
+type rumble struct {
+	rumbleFunc js.Value
+}
+
+// forwards the cartridge rumble motor state to the JS rumble function
+func NewRumble() *rumble {
+	return &rumble{rumbleFunc: js.Global().Get("rumble")}
+}
+
+func (r *rumble) SetRumble(on bool) {
+	r.rumbleFunc.Invoke(on)
+}
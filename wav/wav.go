@@ -0,0 +1,98 @@
+package wav
+
+import (
+	"encoding/binary"
+	go_gb "go-gb"
+	"io"
+	"sync"
+)
+
+const (
+	headerSize    = 44
+	channels      = 2
+	bitsPerSample = 16
+	blockAlign    = channels * bitsPerSample / 8
+)
+
+// audio sink writing 16-bit stereo PCM to a WAV file, sizes in the header are written on Close
+type fileSink struct {
+	w          io.WriteSeeker
+	sampleRate int
+	dataSize   uint32
+
+	buf    []byte
+	err    error
+	closed bool
+	mutex  sync.Mutex
+}
+
+func NewFileSink(w io.WriteSeeker, sampleRate int) (*fileSink, error) {
+	f := &fileSink{w: w, sampleRate: sampleRate}
+	if err := f.writeHeader(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *fileSink) writeHeader() error {
+	var header [headerSize]byte
+	copy(header[0:], "RIFF")
+	binary.LittleEndian.PutUint32(header[4:], headerSize-8+f.dataSize)
+	copy(header[8:], "WAVE")
+	copy(header[12:], "fmt ")
+	binary.LittleEndian.PutUint32(header[16:], 16) // PCM format chunk size
+	binary.LittleEndian.PutUint16(header[20:], 1)  // PCM
+	binary.LittleEndian.PutUint16(header[22:], channels)
+	binary.LittleEndian.PutUint32(header[24:], uint32(f.sampleRate))
+	binary.LittleEndian.PutUint32(header[28:], uint32(f.sampleRate*blockAlign))
+	binary.LittleEndian.PutUint16(header[32:], blockAlign)
+	binary.LittleEndian.PutUint16(header[34:], bitsPerSample)
+	copy(header[36:], "data")
+	binary.LittleEndian.PutUint32(header[40:], f.dataSize)
+	_, err := f.w.Write(header[:])
+	return err
+}
+
+func (f *fileSink) SampleRate() int {
+	return f.sampleRate
+}
+
+func (f *fileSink) Play(frames []go_gb.AudioFrame) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if f.err != nil || f.closed {
+		return
+	}
+	f.buf = f.buf[:0]
+	for _, frame := range frames {
+		f.buf = append(f.buf, byte(frame.Left), byte(uint16(frame.Left)>>8), byte(frame.Right), byte(uint16(frame.Right)>>8))
+	}
+	n, err := f.w.Write(f.buf)
+	f.dataSize += uint32(n)
+	f.err = err
+}
+
+// returns the first error that occurred while writing frames
+func (f *fileSink) Err() error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.err
+}
+
+// rewrites the header with the final sizes, further frames are discarded
+func (f *fileSink) Close() error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if f.err != nil || f.closed {
+		return f.err
+	}
+	f.closed = true
+	if _, err := f.w.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if err := f.writeHeader(); err != nil {
+		return err
+	}
+	_, err := f.w.Seek(0, io.SeekEnd)
+	return err
+}
@@ -0,0 +1,64 @@
+package wav
+
+import (
+	"bytes"
+	"encoding/binary"
+	go_gb "go-gb"
+	"io"
+	"testing"
+)
+
+type seekBuffer struct {
+	data []byte
+	pos  int
+}
+
+func (s *seekBuffer) Write(p []byte) (int, error) {
+	if end := s.pos + len(p); end > len(s.data) {
+		s.data = append(s.data, make([]byte, end-len(s.data))...)
+	}
+	n := copy(s.data[s.pos:], p)
+	s.pos += n
+	return n, nil
+}
+
+func (s *seekBuffer) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+		s.pos = int(offset)
+	case io.SeekEnd:
+		s.pos = len(s.data) + int(offset)
+	default:
+		s.pos += int(offset)
+	}
+	return int64(s.pos), nil
+}
+
+func TestFileSink(t *testing.T) {
+	var buf seekBuffer
+	sink, err := NewFileSink(&buf, go_gb.SampleRate48000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sink.Play([]go_gb.AudioFrame{{Left: 1, Right: -1}, {Left: 0x1234, Right: 0}})
+	if err = sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(buf.data) != headerSize+8 {
+		t.Fatalf("expected %d bytes, got %d\n", headerSize+8, len(buf.data))
+	}
+	if !bytes.Equal(buf.data[0:4], []byte("RIFF")) || !bytes.Equal(buf.data[8:12], []byte("WAVE")) {
+		t.Error("invalid RIFF header")
+	}
+	if size := binary.LittleEndian.Uint32(buf.data[40:]); size != 8 {
+		t.Errorf("expected data size %d, got %d\n", 8, size)
+	}
+	if rate := binary.LittleEndian.Uint32(buf.data[24:]); rate != go_gb.SampleRate48000 {
+		t.Errorf("expected sample rate %d, got %d\n", go_gb.SampleRate48000, rate)
+	}
+	expected := []byte{0x01, 0x00, 0xFF, 0xFF, 0x34, 0x12, 0x00, 0x00}
+	if !bytes.Equal(buf.data[headerSize:], expected) {
+		t.Errorf("expected samples %v, got %v\n", expected, buf.data[headerSize:])
+	}
+}